@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	chunkingFixed = "fixed"
+	//Content defined chunking using a gear rolling hash
+	chunkingCDC = "cdc"
+)
+
+/*
+Parameters chunks of a file are cut with, recorded in manifests so that files can be chunked again the same way.
+*/
+type chunking struct {
+	Method string `json:"method"`
+	//Size of every chunk but the last one for fixed chunking
+	Size int `json:"size,omitempty"`
+	//Bounds and target average size of chunks for content defined chunking
+	Min int `json:"min,omitempty"`
+	Avg int `json:"avg,omitempty"`
+	Max int `json:"max,omitempty"`
+}
+
+/*
+Returns chunking parameters for method, size being the chunk size for fixed chunking and the average one otherwise.
+Content defined chunks are between a quarter and 4 times the average size, which must be a power of 2.
+*/
+func newChunking(method string, size int) (chunking, error) {
+	switch method {
+	case chunkingFixed:
+		c := chunking{Method: method, Size: size}
+		return c, c.validate()
+	case chunkingCDC:
+		c := chunking{Method: method, Min: size / 4, Avg: size, Max: size * 4}
+		return c, c.validate()
+	}
+	return chunking{}, fmt.Errorf("unknown chunking method %q, expected %s or %s", method, chunkingFixed, chunkingCDC)
+}
+
+func (c chunking) validate() error {
+	switch c.Method {
+	case chunkingFixed:
+		if c.Size <= 0 {
+			return fmt.Errorf("invalid chunk size %d", c.Size)
+		}
+		return nil
+	case chunkingCDC:
+		if c.Avg < 64 || c.Avg&(c.Avg-1) != 0 {
+			return fmt.Errorf("average chunk size %d must be a power of 2 of at least 64", c.Avg)
+		}
+		if c.Min <= 0 || c.Min > c.Avg || c.Max < c.Avg {
+			return fmt.Errorf("invalid chunk size bounds [%d, %d] for average size %d", c.Min, c.Max, c.Avg)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown chunking method %q", c.Method)
+}
+
+/*
+Splits a stream into chunks. Next returns io.EOF after the last chunk.
+The returned chunk is only valid until the next call.
+*/
+type chunker interface {
+	Next() ([]byte, error)
+}
+
+func (c chunking) chunker(r io.Reader) (chunker, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.Method == chunkingFixed {
+		return &fixedChunker{r: r, buf: make([]byte, c.Size)}, nil
+	}
+	return &gearChunker{
+		r:    bufio.NewReader(r),
+		min:  c.Min,
+		max:  c.Max,
+		mask: ^uint64(0) << (64 - bits.TrailingZeros(uint(c.Avg))),
+		buf:  make([]byte, 0, c.Max),
+	}, nil
+}
+
+type fixedChunker struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (c *fixedChunker) Next() ([]byte, error) {
+	n, err := io.ReadFull(c.r, c.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	return c.buf[:n], nil
+}
+
+/*
+Cuts a chunk where the gear hash of the bytes read so far has its top log2(avg) bits clear, as done by FastCDC.
+Every byte shifts the hash left by one, so a boundary depends only on the last 64 bytes and
+inserting or removing data changes only the chunks around the edit.
+*/
+type gearChunker struct {
+	r    *bufio.Reader
+	min  int
+	max  int
+	mask uint64
+	buf  []byte
+}
+
+func (c *gearChunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for len(c.buf) < c.max {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		hash = hash<<1 + gearTable[b]
+		if len(c.buf) >= c.min && hash&c.mask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
+
+// Random value per byte value, generated with a fixed seed as manifests depend on it.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	//splitmix64
+	state := uint64(0x6d65726b6c650000)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		table[i] = z ^ z>>31
+	}
+	return table
+}()
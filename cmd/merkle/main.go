@@ -0,0 +1,362 @@
+/*
+Command merkle chunks files into merkle trees and checks their integrity against published roots.
+
+Usage:
+
+	merkle root [-chunker fixed|cdc] [-size bytes] [-hash name] [-branching k] [-manifest path] FILE
+	merkle verify -manifest path -root hex [-chunk index] FILE
+	merkle prove -manifest path -chunk index [-o path]
+	merkle check-proof -proof path -root hex FILE
+
+root prints the root of FILE, "-" reading standard input, and optionally writes a manifest listing its chunks.
+verify checks FILE against a manifest, or with -chunk checks that FILE holds that chunk.
+prove writes a standalone JSON proof for a chunk of a manifest, which check-proof checks against the chunk data.
+verify and check-proof require the published root using -root and fail unless the manifest or proof leads to it,
+as a manifest or proof otherwise only checks out against the root listed in it.
+
+Exit status is 0 if everything checks out, 1 if verification fails and 2 for any other error.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go-ds/merkletree"
+)
+
+// Wrapped by errors reporting data that doesn't match its manifest, proof or root
+var errVerification = errors.New("verification failed")
+
+type command func(args []string, stdout io.Writer, stderr io.Writer) error
+
+var commands = map[string]command{
+	"root":        rootCommand,
+	"verify":      verifyCommand,
+	"prove":       proveCommand,
+	"check-proof": checkProofCommand,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: merkle root|verify|prove|check-proof [flags] [FILE]")
+		return 2
+	}
+	cmd, found := commands[args[0]]
+	if !found {
+		fmt.Fprintf(stderr, "merkle: unknown command %q\n", args[0])
+		return 2
+	}
+	err := cmd(args[1:], stdout, stderr)
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 2
+	}
+	fmt.Fprintf(stderr, "merkle %s: %v\n", args[0], err)
+	if errors.Is(err, errVerification) {
+		return 1
+	}
+	return 2
+}
+
+/*
+Parses flags of a command, which must come before its positional arguments, and checks their count.
+*/
+func parseFlags(fs *flag.FlagSet, args []string, positional int, stderr io.Writer) error {
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != positional {
+		fs.Usage()
+		return fmt.Errorf("expected %d arguments, got %d", positional, fs.NArg())
+	}
+	return nil
+}
+
+func rootCommand(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("root", flag.ContinueOnError)
+	method := fs.String("chunker", chunkingFixed, "chunking method, fixed or cdc for content defined chunks")
+	size := fs.Int("size", 1<<20, "chunk size in bytes, average size for cdc")
+	hashName := fs.String("hash", "sha256", "name of the hash function")
+	branching := fs.Int("branching", 2, "number of children of each node of the tree")
+	manifestPath := fs.String("manifest", "", "path to write the manifest to, - for standard output")
+	if err := parseFlags(fs, args, 1, stderr); err != nil {
+		return err
+	}
+	c, err := newChunking(*method, *size)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	m, err := buildManifest(in, c, *hashName, *branching)
+	if err != nil {
+		return err
+	}
+	if *manifestPath == "-" {
+		return writeJSON("-", m, stdout)
+	}
+	if *manifestPath != "" {
+		if err := writeJSON(*manifestPath, m, stdout); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintln(stdout, m.Root)
+	return err
+}
+
+func verifyCommand(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	manifestPath := fs.String("manifest", "", "path of the manifest")
+	trusted := fs.String("root", "", "published root in hex the manifest must lead to")
+	index := fs.Int("chunk", -1, "verify that FILE holds only this chunk instead of the whole file")
+	if err := parseFlags(fs, args, 1, stderr); err != nil {
+		return err
+	}
+	if err := requireRoot(fs, *trusted); err != nil {
+		return err
+	}
+	m, tree, err := loadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	if err := checkTrustedRoot(*trusted, tree.RootHash()); err != nil {
+		return err
+	}
+	in, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if *index >= 0 {
+		return verifyChunk(m, tree, *index, in, stdout)
+	}
+
+	actual, err := buildManifest(in, m.Chunking, m.Hash, m.Branching)
+	if err != nil {
+		return err
+	}
+	if actual.Root == m.Root {
+		_, err = fmt.Fprintf(stdout, "OK %s\n", m.Root)
+		return err
+	}
+	actualTree, err := actual.buildTree()
+	if err != nil {
+		return err
+	}
+	for _, i := range merkletree.Diff(tree, actualTree) {
+		if i < len(actual.Chunks) {
+			fmt.Fprintf(stdout, "chunk %d at offset %d differs\n", i, actual.Chunks[i].Offset)
+		} else {
+			fmt.Fprintf(stdout, "chunk %d is missing\n", i)
+		}
+	}
+	return fmt.Errorf("%w: root of file is %s, expected %s", errVerification, actual.Root, m.Root)
+}
+
+/*
+Checks that everything read from r is chunk index of the manifest, proving it against the root of tree.
+*/
+func verifyChunk(m *manifest, tree *merkletree.MerkleTree, index int, r io.Reader, stdout io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	proof, err := tree.GenerateMerkleProofByIndex(index)
+	if err != nil {
+		return err
+	}
+	_, fn, err := hashFunc(m.Hash)
+	if err != nil {
+		return err
+	}
+	if _, err := merkletree.VerifyProof(tree.RootHash(), data, proof, fn, treeOptions(m.Branching)...); err != nil {
+		return fmt.Errorf("%w: chunk %d: %v", errVerification, index, err)
+	}
+	_, err = fmt.Fprintf(stdout, "OK chunk %d of %s\n", index, m.Root)
+	return err
+}
+
+func proveCommand(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("prove", flag.ContinueOnError)
+	manifestPath := fs.String("manifest", "", "path of the manifest")
+	index := fs.Int("chunk", 0, "index of the chunk to prove")
+	out := fs.String("o", "-", "path to write the proof to, - for standard output")
+	if err := parseFlags(fs, args, 0, stderr); err != nil {
+		return err
+	}
+	m, tree, err := loadManifest(*manifestPath)
+	if err != nil {
+		return err
+	}
+	proof, err := tree.GenerateMerkleProofByIndex(*index)
+	if err != nil {
+		return err
+	}
+	chunk := m.Chunks[*index]
+	return writeJSON(*out, proofFile{
+		Version:   formatVersion,
+		Hash:      m.Hash,
+		Branching: m.Branching,
+		Root:      m.Root,
+		LeafCount: len(m.Chunks),
+		Chunk:     *index,
+		Offset:    chunk.Offset,
+		Length:    chunk.Length,
+		Proof:     proof,
+	}, stdout)
+}
+
+func checkProofCommand(args []string, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("check-proof", flag.ContinueOnError)
+	proofPath := fs.String("proof", "", "path of the proof")
+	trusted := fs.String("root", "", "published root in hex the proof must lead to")
+	if err := parseFlags(fs, args, 1, stderr); err != nil {
+		return err
+	}
+	if err := requireRoot(fs, *trusted); err != nil {
+		return err
+	}
+	var p proofFile
+	if err := readJSON(*proofPath, &p); err != nil {
+		return err
+	}
+	if p.Version != formatVersion {
+		return fmt.Errorf("unsupported proof version %d", p.Version)
+	}
+	if p.Proof == nil {
+		return fmt.Errorf("%s holds no proof", *proofPath)
+	}
+	root, err := hex.DecodeString(p.Root)
+	if err != nil {
+		return fmt.Errorf("invalid root: %v", err)
+	}
+	if err := checkTrustedRoot(*trusted, root); err != nil {
+		return err
+	}
+	_, fn, err := hashFunc(p.Hash)
+	if err != nil {
+		return err
+	}
+	in, err := openInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if _, err := merkletree.VerifyProof(root, data, p.Proof, fn, treeOptions(p.Branching)...); err != nil {
+		return fmt.Errorf("%w: chunk %d: %v", errVerification, p.Chunk, err)
+	}
+	//The proof only leads to the root, the chunk it is of follows from the path it takes
+	position, err := leafPosition(p.Proof, p.LeafCount, p.Branching)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errVerification, err)
+	}
+	if position != p.Chunk {
+		return fmt.Errorf("%w: proof is of chunk %d, not chunk %d", errVerification, position, p.Chunk)
+	}
+	if len(data) != p.Length {
+		return fmt.Errorf("%w: chunk %d is %d bytes, expected %d", errVerification, p.Chunk, len(data), p.Length)
+	}
+	_, err = fmt.Fprintf(stdout, "OK chunk %d of %s\n", p.Chunk, p.Root)
+	return err
+}
+
+/*
+Returns position of the leaf a proof is of, following its path from the root down through a tree of leafCount leaves
+built using odd node promotion, where a node alone in its group is promoted without a proof entry.
+*/
+func leafPosition(proof *merkletree.Proof, leafCount int, branching int) (int, error) {
+	if leafCount <= 0 {
+		return 0, fmt.Errorf("proof is of a tree with %d leaves", leafCount)
+	}
+	k := branching
+	if k < 2 {
+		k = 2
+	}
+	counts := []int{leafCount}
+	for counts[len(counts)-1] > 1 {
+		counts = append(counts, (counts[len(counts)-1]+k-1)/k)
+	}
+	index := 0
+	entry := len(proof.Indexes)
+	for level := len(counts) - 2; level >= 0; level-- {
+		first := index * k
+		size := counts[level] - first
+		if size > k {
+			size = k
+		}
+		if size == 1 {
+			index = first
+			continue
+		}
+		if entry == 0 {
+			return 0, fmt.Errorf("proof has %d entries, too few for a tree with %d leaves", len(proof.Indexes), leafCount)
+		}
+		entry--
+		position := proof.Indexes[entry]
+		if k == 2 {
+			//Index 1 of a binary tree proof means the sibling is on the right
+			position = 1 - position
+		}
+		if position < 0 || position >= size {
+			return 0, fmt.Errorf("invalid position %d among %d nodes at level %d", position, size, level)
+		}
+		index = first + position
+	}
+	if entry != 0 {
+		return 0, fmt.Errorf("proof has %d entries, too many for a tree with %d leaves", len(proof.Indexes), leafCount)
+	}
+	return index, nil
+}
+
+/*
+Returns error unless the published root is passed, without which data would only be checked against the root
+listed in the manifest or proof itself.
+*/
+func requireRoot(fs *flag.FlagSet, trusted string) error {
+	if trusted == "" {
+		fs.Usage()
+		return fmt.Errorf("-root is required, data left unverified as it would only be checked against the root listed in the manifest or proof")
+	}
+	return nil
+}
+
+/*
+Returns error if root differs from the trusted one.
+*/
+func checkTrustedRoot(trusted string, root []byte) error {
+	expected, err := hex.DecodeString(trusted)
+	if err != nil {
+		return fmt.Errorf("invalid root %q: %v", trusted, err)
+	}
+	if !bytes.Equal(expected, root) {
+		return fmt.Errorf("%w: root is %x, expected %s", errVerification, root, trusted)
+	}
+	return nil
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-ds/merkletree"
+)
+
+func randomBytes(size int, seed int64) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func chunkAll(t *testing.T, c chunking, data []byte) [][]byte {
+	t.Helper()
+	chunks, err := c.chunker(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create chunker due to error %v", err)
+	}
+	var all [][]byte
+	for {
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Fatalf("Failed to read chunk due to error %v", err)
+		}
+		all = append(all, append([]byte(nil), chunk...))
+	}
+}
+
+func TestFixedChunking(t *testing.T) {
+	c, _ := newChunking(chunkingFixed, 100)
+	chunks := chunkAll(t, c, randomBytes(250, 1))
+	if len(chunks) != 3 || len(chunks[0]) != 100 || len(chunks[2]) != 50 {
+		t.Fatalf("Expected chunks of 100, 100 and 50 bytes, got %d chunks", len(chunks))
+	}
+	if chunks := chunkAll(t, c, nil); len(chunks) != 0 {
+		t.Fatalf("Expected no chunks for empty input, got %d", len(chunks))
+	}
+}
+
+func TestContentDefinedChunking(t *testing.T) {
+	c, err := newChunking(chunkingCDC, 1024)
+	if err != nil {
+		t.Fatalf("Failed to create chunking due to error %v", err)
+	}
+	data := randomBytes(1<<18, 2)
+	chunks := chunkAll(t, c, data)
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatalf("Chunks don't add up to the input")
+	}
+	for i, chunk := range chunks[:len(chunks)-1] {
+		if len(chunk) < c.Min || len(chunk) > c.Max {
+			t.Fatalf("Chunk %d of %d bytes is outside [%d, %d]", i, len(chunk), c.Min, c.Max)
+		}
+	}
+	if average := len(data) / len(chunks); average < c.Avg/2 || average > c.Avg*2 {
+		t.Fatalf("Average chunk size %d is far from %d", average, c.Avg)
+	}
+
+	//Inserting data at the start only changes the chunks around it
+	edited := chunkAll(t, c, append([]byte("inserted"), data...))
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+	shared := 0
+	for _, chunk := range edited {
+		if seen[string(chunk)] {
+			shared++
+		}
+	}
+	if shared < len(chunks)-2 {
+		t.Fatalf("Only %d of %d chunks are unchanged after inserting at the start", shared, len(chunks))
+	}
+
+	for _, size := range []int{0, 100, 32} {
+		if _, err := newChunking(chunkingCDC, size); err == nil {
+			t.Fatalf("Expected error for average chunk size %d", size)
+		}
+	}
+}
+
+func runCommand(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	for _, flags := range [][]string{
+		{"-size", "4096"},
+		{"-chunker", "cdc", "-size", "1024", "-hash", "sha3-256"},
+		{"-size", "4096", "-branching", "4"},
+	} {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "artifact")
+		manifestPath := filepath.Join(dir, "manifest.json")
+		data := randomBytes(100000, 3)
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatalf("Failed to write file due to error %v", err)
+		}
+
+		code, out := runCommand(t, append(append([]string{"root"}, flags...), "-manifest", manifestPath, file)...)
+		if code != 0 {
+			t.Fatalf("root failed with %d: %s", code, out)
+		}
+		root := strings.TrimSpace(out)
+		if code, out := runCommand(t, "verify", "-manifest", manifestPath, "-root", root, file); code != 0 {
+			t.Fatalf("verify failed with %d: %s", code, out)
+		}
+		if code, out := runCommand(t, "verify", "-manifest", manifestPath, file); code != 2 || !strings.Contains(out, "-root is required") {
+			t.Fatalf("Expected verify without -root to fail with 2, got %d: %s", code, out)
+		}
+		if code, out := runCommand(t, "verify", "-manifest", manifestPath, "-root", strings.Repeat("00", len(root)/2), file); code != 1 {
+			t.Fatalf("Expected verify against another root to fail with 1, got %d: %s", code, out)
+		}
+
+		var m manifest
+		if err := readJSON(manifestPath, &m); err != nil {
+			t.Fatalf("Failed to read manifest due to error %v", err)
+		}
+		index := len(m.Chunks) / 2
+		chunk := m.Chunks[index]
+		chunkPath := filepath.Join(dir, "chunk")
+		os.WriteFile(chunkPath, data[chunk.Offset:chunk.Offset+int64(chunk.Length)], 0644)
+		if code, out := runCommand(t, "verify", "-manifest", manifestPath, "-root", root, "-chunk", strconv.Itoa(index), chunkPath); code != 0 {
+			t.Fatalf("verify of chunk %d failed with %d: %s", index, code, out)
+		}
+
+		proofPath := filepath.Join(dir, "proof.json")
+		if code, out := runCommand(t, "prove", "-manifest", manifestPath, "-chunk", strconv.Itoa(index), "-o", proofPath); code != 0 {
+			t.Fatalf("prove failed with %d: %s", code, out)
+		}
+		if code, out := runCommand(t, "check-proof", "-proof", proofPath, "-root", root, chunkPath); code != 0 {
+			t.Fatalf("check-proof failed with %d: %s", code, out)
+		}
+		if code, out := runCommand(t, "check-proof", "-proof", proofPath, chunkPath); code != 2 || !strings.Contains(out, "-root is required") {
+			t.Fatalf("Expected check-proof without -root to fail with 2, got %d: %s", code, out)
+		}
+		var p proofFile
+		readJSON(proofPath, &p)
+		p.Chunk = index + 1
+		relabeled := filepath.Join(dir, "relabeled.json")
+		writeJSON(relabeled, p, io.Discard)
+		if code, out := runCommand(t, "check-proof", "-proof", relabeled, "-root", root, chunkPath); code != 1 || !strings.Contains(out, "proof is of chunk "+strconv.Itoa(index)) {
+			t.Fatalf("Expected check-proof of a proof relabeled as another chunk to fail with 1, got %d: %s", code, out)
+		}
+		if code, out := runCommand(t, "check-proof", "-proof", proofPath, "-root", root, file); code != 1 {
+			t.Fatalf("Expected check-proof of the whole file to fail with 1, got %d: %s", code, out)
+		}
+
+		data[chunk.Offset] ^= 0xff
+		os.WriteFile(file, data, 0644)
+		code, out = runCommand(t, "verify", "-manifest", manifestPath, "-root", root, file)
+		if code != 1 || !strings.Contains(out, "chunk "+strconv.Itoa(index)+" at offset") {
+			t.Fatalf("Expected verify to report chunk %d, got %d: %s", index, code, out)
+		}
+	}
+}
+
+func TestLeafPosition(t *testing.T) {
+	_, fn, _ := hashFunc("sha256")
+	for _, branching := range []int{2, 3, 4} {
+		for count := 1; count <= 40; count++ {
+			hashes := make([][]byte, count)
+			for i := range hashes {
+				hashes[i] = randomBytes(32, int64(i))
+			}
+			tree, err := merkletree.NewTreeFromLeafHashes(hashes, fn, treeOptions(branching)...)
+			if err != nil {
+				t.Fatalf("Failed to build tree due to error %v", err)
+			}
+			for i := 0; i < count; i++ {
+				proof, _ := tree.GenerateMerkleProofByIndex(i)
+				if position, err := leafPosition(proof, count, branching); err != nil || position != i {
+					t.Fatalf("Expected position %d of %d leaves with branching %d, got %d and error %v", i, count, branching, position, err)
+				}
+			}
+			if count > 1 {
+				proof, _ := tree.GenerateMerkleProofByIndex(count - 1)
+				if _, err := leafPosition(proof, count*branching, branching); err == nil {
+					t.Fatalf("Expected error for proof of %d leaves checked against %d", count, count*branching)
+				}
+			}
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	if code, _ := runCommand(t); code != 2 {
+		t.Fatalf("Expected 2 without a command, got %d", code)
+	}
+	if code, _ := runCommand(t, "sign"); code != 2 {
+		t.Fatalf("Expected 2 for unknown command, got %d", code)
+	}
+	if code, _ := runCommand(t, "root", "-chunker", "lines", "file"); code != 2 {
+		t.Fatalf("Expected 2 for unknown chunking method, got %d", code)
+	}
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	os.WriteFile(empty, nil, 0644)
+	if code, out := runCommand(t, "root", empty); code != 0 || len(strings.TrimSpace(out)) != 64 {
+		t.Fatalf("Expected root of an empty file, got %d: %s", code, out)
+	}
+	tampered := filepath.Join(dir, "manifest.json")
+	runCommand(t, "root", "-manifest", tampered, empty)
+	var parsed manifest
+	readJSON(tampered, &parsed)
+	parsed.Root = strings.Repeat("ab", 32)
+	writeJSON(tampered, parsed, io.Discard)
+	if code, out := runCommand(t, "verify", "-manifest", tampered, "-root", parsed.Root, empty); code != 1 || !strings.Contains(out, "doesn't match its chunks") {
+		t.Fatalf("Expected manifest with wrong root to fail with 1, got %d: %s", code, out)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go-ds/merkletree"
+)
+
+// Version of the manifest and proof file formats
+const formatVersion = 1
+
+/*
+Lists the chunks of a file along with the leaf hashes and root of the tree built from them.
+Trees are built using domain separation and odd node promotion, so roots of binary trees match RFC 6962.
+*/
+type manifest struct {
+	Version int    `json:"version"`
+	Hash    string `json:"hash"`
+	//Branching factor of the tree, left out for binary trees
+	Branching int          `json:"branching,omitempty"`
+	Chunking  chunking     `json:"chunking"`
+	Size      int64        `json:"size"`
+	Root      string       `json:"root"`
+	Chunks    []chunkEntry `json:"chunks"`
+}
+
+type chunkEntry struct {
+	Offset int64 `json:"offset"`
+	Length int   `json:"length"`
+	//Leaf hash of the chunk
+	Hash string `json:"hash"`
+}
+
+/*
+Standalone proof that a chunk is part of the file with the given root, checked without the manifest.
+*/
+type proofFile struct {
+	Version   int               `json:"version"`
+	Hash      string            `json:"hash"`
+	Branching int               `json:"branching,omitempty"`
+	Root      string            `json:"root"`
+	LeafCount int               `json:"leafCount"`
+	Chunk     int               `json:"chunk"`
+	Offset    int64             `json:"offset"`
+	Length    int               `json:"length"`
+	Proof     *merkletree.Proof `json:"proof"`
+}
+
+func treeOptions(branching int) []merkletree.Option {
+	return []merkletree.Option{
+		merkletree.WithRFC6962(),
+		merkletree.WithBranching(branching),
+	}
+}
+
+func hashFunc(name string) (merkletree.HashID, merkletree.HashFunction, error) {
+	id, err := merkletree.LookupHash(name)
+	if err != nil {
+		return merkletree.HashUnknown, nil, err
+	}
+	fn, err := id.HashFunc()
+	return id, fn, err
+}
+
+/*
+Chunks everything read from r and returns the manifest of the resulting tree.
+An empty input is a single empty chunk, so that every file has a root.
+*/
+func buildManifest(r io.Reader, c chunking, hashName string, branching int) (*manifest, error) {
+	_, fn, err := hashFunc(hashName)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := c.chunker(r)
+	if err != nil {
+		return nil, err
+	}
+	m := manifest{Version: formatVersion, Hash: hashName, Chunking: c}
+	if branching > 2 {
+		m.Branching = branching
+	}
+	for {
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := m.addChunk(chunk, fn); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.Chunks) == 0 {
+		if err := m.addChunk(nil, fn); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := m.buildTree()
+	if err != nil {
+		return nil, err
+	}
+	m.Root = hex.EncodeToString(tree.RootHash())
+	return &m, nil
+}
+
+func (m *manifest) addChunk(chunk []byte, fn merkletree.HashFunction) error {
+	hash, err := merkletree.HashLeaf(chunk, fn, treeOptions(m.Branching)...)
+	if err != nil {
+		return err
+	}
+	m.Chunks = append(m.Chunks, chunkEntry{Offset: m.Size, Length: len(chunk), Hash: hex.EncodeToString(hash)})
+	m.Size += int64(len(chunk))
+	return nil
+}
+
+/*
+Builds the tree from the leaf hashes listed in the manifest.
+*/
+func (m *manifest) buildTree() (*merkletree.MerkleTree, error) {
+	id, fn, err := hashFunc(m.Hash)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, len(m.Chunks))
+	for i, chunk := range m.Chunks {
+		if hashes[i], err = hex.DecodeString(chunk.Hash); err != nil {
+			return nil, fmt.Errorf("invalid hash of chunk %d: %v", i, err)
+		}
+	}
+	tree, err := merkletree.NewTreeFromLeafHashes(hashes, fn, treeOptions(m.Branching)...)
+	if err != nil {
+		return nil, err
+	}
+	tree.HashID = id
+	return tree, nil
+}
+
+/*
+Reads a manifest and builds its tree, checking that the tree leads to the root listed in it.
+*/
+func loadManifest(path string) (*manifest, *merkletree.MerkleTree, error) {
+	var m manifest
+	if err := readJSON(path, &m); err != nil {
+		return nil, nil, err
+	}
+	if m.Version != formatVersion {
+		return nil, nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if err := m.Chunking.validate(); err != nil {
+		return nil, nil, err
+	}
+	tree, err := m.buildTree()
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := hex.DecodeString(m.Root)
+	if err != nil || !bytes.Equal(root, tree.RootHash()) {
+		return nil, nil, fmt.Errorf("%w: manifest root %s doesn't match its chunks", errVerification, m.Root)
+	}
+	return &m, tree, nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s: %v", path, err)
+	}
+	return nil
+}
+
+/*
+Writes v as indented JSON to path, or to stdout if path is "-".
+*/
+func writeJSON(path string, v interface{}, stdout io.Writer) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -3,6 +3,12 @@ module go-ds
 go 1.20
 
 require (
-	github.com/tmthrgd/go-memset v0.0.0-20190904060434-6fb7a21f88f1 // indirect
-	golang.org/x/sys v0.6.0 // indirect
+	github.com/tmthrgd/go-memset v0.0.0-20190904060434-6fb7a21f88f1
+	golang.org/x/crypto v0.33.0
+	lukechampine.com/blake3 v1.3.0
+)
+
+require (
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	golang.org/x/sys v0.30.0 // indirect
 )
@@ -0,0 +1,135 @@
+package merkletree
+
+/*
+Appends a new leaf to the end of the tree, or inserts it at its sorted position in a tree built using WithSortedLeaves.
+Only the nodes on the path from the new leaf to the root are created or rehashed, so it takes O(log n) hash computations.
+Accepts
+  - data for the new leaf
+
+Returns
+  - error in case any error occurs while hashing
+*/
+func (t *MerkleTree) AppendLeaf(data []byte) error {
+	hash, err := t.hashLeaf(data)
+	if err != nil {
+		return err
+	}
+	if t.config.sortedLeaves {
+		return t.insertSortedLeaf(data, hash)
+	}
+	if t.config.store != nil {
+		return t.storeAppendLeaf(hash)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return err
+	}
+	index := t.LeafCount()
+	if t.config.arity() > 2 {
+		//Only the last group of each level changes, so rebuilding from the new leaf takes O(k log n) hash computations.
+		leaf, err := buildLeafNode(data, hash, t)
+		if err != nil {
+			return err
+		}
+		t.leafIndex.add(hash, index)
+		t.Leaves = append(t.Leaves, leaf)
+		return t.rebuildFrom(index)
+	}
+	if !t.config.promoteOddNodes && index%2 == 1 {
+		//Leaf count becomes even, the duplicate leaf padding the odd count takes the new value.
+		pad := t.Leaves[index]
+		pad.Hash = hash
+		pad.Data = data
+		pad.IsDuplicate = false
+		t.leafIndex.add(hash, index)
+		return t.rehashPath(pad.Parent)
+	}
+
+	leaf, err := buildLeafNode(data, hash, t)
+	if err != nil {
+		return err
+	}
+	t.leafIndex.add(hash, index)
+	if t.config.promoteOddNodes {
+		err = t.appendNode(0, leaf)
+	} else {
+		err = t.appendPaddedLeaf(leaf)
+	}
+	t.Leaves = t.levels[0]
+	t.Depth = len(t.levels) - 1
+	return err
+}
+
+/*
+Appends leaf along with a duplicate padding leaf as leaf count becomes odd.
+*/
+func (t *MerkleTree) appendPaddedLeaf(leaf *Node) error {
+	pad, err := buildLeafNode(leaf.Data, leaf.Hash, t)
+	if err != nil {
+		return err
+	}
+	pad.IsDuplicate = true
+	t.levels[0] = append(t.levels[0], leaf, pad)
+	parent, err := createNonLeafNode(leaf, pad, t)
+	if err != nil {
+		return err
+	}
+	return t.appendNode(1, parent)
+}
+
+/*
+Adds node at the end of the given level and fixes up the levels above it.
+*/
+func (t *MerkleTree) appendNode(level int, node *Node) error {
+	t.levels[level] = append(t.levels[level], node)
+	index := len(t.levels[level]) - 1
+	if level == len(t.levels)-1 {
+		//Level held only the root, the tree grows by a level.
+		root, err := createNonLeafNode(t.levels[level][0], node, t)
+		if err != nil {
+			return err
+		}
+		t.levels = append(t.levels, []*Node{root})
+		t.Root = root
+		return nil
+	}
+	if index%2 == 0 {
+		//No sibling for the new node.
+		if t.config.promoteOddNodes {
+			return t.appendNode(level+1, node)
+		}
+		parent, err := createNonLeafNode(node, node, t)
+		if err != nil {
+			return err
+		}
+		return t.appendNode(level+1, parent)
+	}
+
+	//The previously unpaired node at the end of the level gets the new node as sibling.
+	sibling := t.levels[level][index-1]
+	if !t.config.promoteOddNodes {
+		parent := t.levels[level+1][index/2]
+		parent.Right = node
+		node.Parent = parent
+		return t.rehashPath(parent)
+	}
+	//Replace the promoted sibling with the new parent in the levels above and under its old parent.
+	oldParent := sibling.Parent
+	parent, err := createNonLeafNode(sibling, node, t)
+	if err != nil {
+		return err
+	}
+	for l, i := level+1, index/2; l < len(t.levels) && t.levels[l][i] == sibling; l, i = l+1, i/2 {
+		t.levels[l][i] = parent
+	}
+	parent.Parent = oldParent
+	if oldParent == nil {
+		t.Root = parent
+		return nil
+	}
+	if oldParent.Left == sibling {
+		oldParent.Left = parent
+	} else {
+		oldParent.Right = parent
+	}
+	return t.rehashPath(oldParent)
+}
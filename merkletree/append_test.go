@@ -0,0 +1,88 @@
+package merkletree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendLeaf(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}, {WithDomainSeparation(), WithOddNodePromotion()}} {
+		data := testData(70)
+		initial := data[:1]
+		tree, err := NewTree(&initial, HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		for count := 2; count <= len(data); count++ {
+			if err := tree.AppendLeaf(data[count-1]); err != nil {
+				t.Fatalf("Failed to append leaf %d due to error %v", count-1, err)
+			}
+			prefix := data[:count]
+			expected, _ := NewTree(&prefix, HashFuncSHA256, opts...)
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+				t.Fatalf("Root after appending to %d leaves doesn't match rebuilt tree", count)
+			}
+			if tree.Depth != expected.Depth || tree.LeafCount() != count || len(tree.Leaves) != len(expected.Leaves) {
+				t.Fatalf("Tree with %d leaves has depth %d and %d leaves, expected depth %d and %d leaves",
+					count, tree.Depth, len(tree.Leaves), expected.Depth, len(expected.Leaves))
+			}
+			for level := range expected.levels {
+				for i, node := range expected.levels[level] {
+					if !bytes.Equal(tree.levels[level][i].Hash, node.Hash) {
+						t.Fatalf("Node %d at level %d doesn't match rebuilt tree with %d leaves", i, level, count)
+					}
+				}
+			}
+			for _, i := range []int{0, count / 2, count - 1} {
+				proof, err := tree.GenerateMerkleProof(&data[i])
+				if err != nil {
+					t.Fatalf("Failed to generate Merkle Proof for leaf %d due to error %v", i, err)
+				}
+				if verified, err := tree.VerifyProof(&data[i], proof); !verified {
+					t.Fatalf("Failed to verify Merkle Proof for leaf %d of %d due to error %v", i, count, err)
+				}
+			}
+		}
+		if err := tree.UpdateLeafAt(len(data)-1, []byte("updated")); err != nil {
+			t.Fatalf("Failed to update appended leaf due to error %v", err)
+		}
+		data[len(data)-1] = []byte("updated")
+		expected, _ := NewTree(&data, HashFuncSHA256, opts...)
+		if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+			t.Fatalf("Root after updating appended leaf doesn't match rebuilt tree")
+		}
+	}
+}
+
+func TestAppendLeafParity(t *testing.T) {
+	data := testData(3)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	if !tree.Leaves[3].IsDuplicate {
+		t.Fatalf("Expected duplicate padding leaf for odd leaf count")
+	}
+	tree.AppendLeaf([]byte("fourth"))
+	if len(tree.Leaves) != 4 || tree.Leaves[3].IsDuplicate {
+		t.Fatalf("Expected padding leaf to be replaced when leaf count becomes even")
+	}
+	tree.AppendLeaf([]byte("fifth"))
+	if len(tree.Leaves) != 6 || !tree.Leaves[5].IsDuplicate || tree.LeafCount() != 5 {
+		t.Fatalf("Expected new padding leaf when leaf count becomes odd")
+	}
+	fifth := []byte("fifth")
+	proof, err := tree.GenerateMerkleProof(&fifth)
+	if err != nil || !bytes.Equal(proof.Hashes[0], tree.Leaves[4].Hash) {
+		t.Fatalf("Expected padding leaf as sibling in proof for the last leaf")
+	}
+}
+
+func BenchmarkMerkleTreeAppend5000(b *testing.B) {
+	data := testData(5000)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	leaf := []byte("Hello")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tree.AppendLeaf(leaf); err != nil {
+			b.FailNow()
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+Computes the root of a tree one leaf at a time, without keeping the leaves.
+Only the root of every complete subtree that is still waiting for a sibling is held, so memory use is O(log n).
+Root is the same as the one of a tree built using NewTree from the same leaves and options.
+*/
+type Builder struct {
+	HashFunc HashFunction
+	config   treeConfig
+	//Root of a pending complete subtree at each level, nil if there is none
+	pending [][]byte
+	count   int
+}
+
+/*
+Creates a Builder using the hash function and options the tree would be built with.
+Accepts
+  - Hash function to be used for hashing
+  - Optional settings changing how the tree is built, WithDomainSeparation, WithOddNodePromotion, WithSortedPairs
+    and WithBranching of 2 apply. WithSortedLeaves is not supported as it needs all leaves, and options that only
+    change how a tree is kept in memory, such as WithWorkers, WithNodeStore and WithLazyLevels, are rejected.
+
+Returns
+  - Reference to the builder in case of no errors
+  - error in case hash function is insecure or an unsupported option is passed
+*/
+func NewBuilder(hashFunc HashFunction, opts ...Option) (*Builder, error) {
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	config := newTreeConfig(opts)
+	if config.sortedLeaves {
+		return nil, fmt.Errorf("%w: sorted leaves can't be built incrementally", ErrUnsupported)
+	}
+	if config.arity() > 2 {
+		return nil, fmt.Errorf("%w: trees with branching factor %d can't be built incrementally", ErrUnsupported, config.branching)
+	}
+	if config.workers != 0 || config.store != nil || config.lazyLevels {
+		return nil, fmt.Errorf("%w: WithWorkers, WithNodeStore and WithLazyLevels don't apply to a Builder", ErrUnsupported)
+	}
+	return &Builder{HashFunc: hashFunc, config: config}, nil
+}
+
+/*
+Adds a leaf after the ones pushed so far. leaf is not retained and may be reused by the caller.
+Accepts
+  - data for the leaf
+
+Returns
+  - error in case any error occurs while hashing
+*/
+func (b *Builder) Push(leaf []byte) error {
+	hash, err := b.config.hashLeaf(b.HashFunc, leaf)
+	if err != nil {
+		return err
+	}
+	level := 0
+	//Merge with pending subtrees of the same size, like carrying in binary addition
+	for ; level < len(b.pending) && b.pending[level] != nil; level++ {
+		hash, err = b.config.hashNode(b.HashFunc, b.pending[level], hash)
+		if err != nil {
+			return err
+		}
+		b.pending[level] = nil
+	}
+	if level == len(b.pending) {
+		b.pending = append(b.pending, nil)
+	}
+	b.pending[level] = hash
+	b.count++
+	return nil
+}
+
+/*
+Splits everything read from r into chunks of chunkSize bytes and pushes each of them as a leaf.
+The last chunk can be shorter.
+Accepts
+  - reader to consume till EOF
+  - size of each chunk in bytes
+
+Returns
+  - error in case reading or hashing fails
+*/
+func (b *Builder) PushReader(r io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		return fmt.Errorf("%w: chunk size %d, expected a positive size", ErrUnsupported, chunkSize)
+	}
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			if err := b.Push(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+/*
+Returns the number of leaves pushed so far.
+*/
+func (b *Builder) Len() int {
+	return b.count
+}
+
+/*
+Returns the root of the tree holding the leaves pushed so far. More leaves can be pushed afterwards.
+Returns
+  - root hash
+  - error in case no leaf has been pushed or hashing fails
+*/
+func (b *Builder) Root() ([]byte, error) {
+	if b.count == 0 {
+		return nil, ErrEmptyData
+	}
+	depth := b.config.depth(b.count)
+	//Rightmost node of the current level, covering the leaves to the right of the pending subtrees below it
+	var carry []byte
+	var err error
+	for level := 0; level < depth; level++ {
+		var left []byte
+		if level < len(b.pending) {
+			left = b.pending[level]
+		}
+		switch {
+		case left != nil && carry != nil:
+			carry, err = b.config.hashNode(b.HashFunc, left, carry)
+		case left == nil && carry == nil:
+			continue
+		case left == nil:
+			left = carry
+			fallthrough
+		default:
+			//Last node of the level is unpaired
+			if b.config.promoteOddNodes {
+				carry = left
+			} else {
+				carry, err = b.config.hashNode(b.HashFunc, left, left)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if carry == nil {
+		return b.pending[depth], nil
+	}
+	return carry, nil
+}
@@ -0,0 +1,87 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestBuilderMatchesNewTree(t *testing.T) {
+	modes := [][]Option{nil, {WithOddNodePromotion()}, {WithDomainSeparation(), WithOddNodePromotion()}, {WithSortedPairs()}}
+	for _, opts := range modes {
+		builder, err := NewBuilder(HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create Builder due to error %v", err)
+		}
+		if _, err := builder.Root(); err == nil {
+			t.Fatalf("Expected error getting root without any leaves")
+		}
+		data := testData(70)
+		for i := range data {
+			if err := builder.Push(data[i]); err != nil {
+				t.Fatalf("Failed to push leaf due to error %v", err)
+			}
+			root, err := builder.Root()
+			if err != nil {
+				t.Fatalf("Failed to compute root due to error %v", err)
+			}
+			leaves := data[:i+1]
+			tree, _ := NewTree(&leaves, HashFuncSHA256, opts...)
+			if !bytes.Equal(root, tree.RootHash()) || builder.Len() != i+1 {
+				t.Fatalf("Root of %d pushed leaves doesn't match NewTree", i+1)
+			}
+		}
+	}
+	if _, err := NewBuilder(HashFuncSHA256, WithSortedLeaves()); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported creating a Builder with sorted leaves, got %v", err)
+	}
+	if _, err := NewBuilder(HashFuncSHA256, WithBranching(4)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported creating a Builder with branching factor 4, got %v", err)
+	}
+	for _, opt := range []Option{WithWorkers(4), WithNodeStore(NewMemoryNodeStore()), WithLazyLevels()} {
+		if _, err := NewBuilder(HashFuncSHA256, opt); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("Expected ErrUnsupported creating a Builder with an option it ignores, got %v", err)
+		}
+	}
+}
+
+func TestBuilderPushReader(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 100)
+	for _, chunkSize := range []int{1, 64, 100, 1600, 4096} {
+		builder, _ := NewBuilder(HashFuncSHA256, WithDomainSeparation(), WithOddNodePromotion())
+		if err := builder.PushReader(bytes.NewReader(content), chunkSize); err != nil {
+			t.Fatalf("Failed to push reader due to error %v", err)
+		}
+		var data Data
+		for start := 0; start < len(content); start += chunkSize {
+			end := start + chunkSize
+			if end > len(content) {
+				end = len(content)
+			}
+			data = append(data, content[start:end])
+		}
+		tree, _ := NewTree(&data, HashFuncSHA256, WithDomainSeparation(), WithOddNodePromotion())
+		root, err := builder.Root()
+		if err != nil {
+			t.Fatalf("Failed to compute root due to error %v", err)
+		}
+		if !bytes.Equal(root, tree.RootHash()) {
+			t.Fatalf("Root of reader split in %d byte chunks doesn't match NewTree", chunkSize)
+		}
+	}
+	builder, _ := NewBuilder(HashFuncSHA256)
+	if err := builder.PushReader(bytes.NewReader(content), 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for chunk size 0, got %v", err)
+	}
+}
+
+func BenchmarkBuilderPush5000(b *testing.B) {
+	data := testData(5000)
+	for i := 0; i < b.N; i++ {
+		builder, _ := NewBuilder(HashFuncSHA256)
+		for _, leaf := range data {
+			builder.Push(leaf)
+		}
+		builder.Root()
+	}
+}
@@ -0,0 +1,202 @@
+package merkletree
+
+import "sync"
+
+/*
+Merkle tree safe for use by multiple goroutines, e.g. handlers serving proofs while others append and update leaves.
+Reads hold a shared lock and see the tree between two writes, writes hold it exclusively.
+Proofs are returned along with the root they were generated against, so a proof always verifies against the root it came with
+even if the tree changes right after. The hash function of the tree must be safe for concurrent use, as all registered ones are.
+*/
+type ConcurrentTree struct {
+	lock sync.RWMutex
+	tree *MerkleTree
+}
+
+/*
+Wraps tree for concurrent use. The tree must not be used directly afterwards other than through View and Update.
+Everything the tree would otherwise build on first read, the leaf index and levels of a snapshot read using WithLazyLevels,
+is built here so that reads never modify the tree.
+Accepts
+  - tree to wrap
+
+Returns
+  - Reference to a ConcurrentTree object
+  - error in case lazily loaded levels don't lead to the root of the snapshot
+*/
+func NewConcurrentTree(tree *MerkleTree) (*ConcurrentTree, error) {
+	if err := tree.ensureLevels(); err != nil {
+		return nil, err
+	}
+	if tree.config.store == nil && tree.leafIndex == nil {
+		tree.buildLeafIndex()
+	}
+	return &ConcurrentTree{tree: tree}, nil
+}
+
+/*
+Returns a copy of the current root hash.
+*/
+func (c *ConcurrentTree) RootHash() []byte {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]byte(nil), c.tree.RootHash()...)
+}
+
+/*
+Returns the current number of leaves.
+*/
+func (c *ConcurrentTree) LeafCount() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.LeafCount()
+}
+
+/*
+Returns the number of leading leaves pruned using Prune.
+*/
+func (c *ConcurrentTree) PrunedCount() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tree.PrunedCount()
+}
+
+/*
+Same as MerkleTree.GenerateMerkleProof, also returning the root the proof leads to.
+*/
+func (c *ConcurrentTree) GenerateMerkleProof(data *[]byte) (*Proof, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	proof, err := c.tree.GenerateMerkleProof(data)
+	return proof, c.rootOf(err), err
+}
+
+/*
+Same as MerkleTree.GenerateMerkleProofByIndex, also returning the root the proof leads to.
+*/
+func (c *ConcurrentTree) GenerateMerkleProofByIndex(index int) (*Proof, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	proof, err := c.tree.GenerateMerkleProofByIndex(index)
+	return proof, c.rootOf(err), err
+}
+
+/*
+Same as MerkleTree.GeneratePrunedProof, also returning the root the proof leads to.
+*/
+func (c *ConcurrentTree) GeneratePrunedProof(index int, data Data) (*Proof, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	proof, err := c.tree.GeneratePrunedProof(index, data)
+	return proof, c.rootOf(err), err
+}
+
+/*
+Same as MerkleTree.GenerateMultiProof, also returning the root the proof leads to.
+*/
+func (c *ConcurrentTree) GenerateMultiProof(indices []int) (*MultiProof, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	proof, err := c.tree.GenerateMultiProof(indices)
+	return proof, c.rootOf(err), err
+}
+
+/*
+Returns a copy of the root unless a proof failed with err. Must be called holding the lock.
+*/
+func (c *ConcurrentTree) rootOf(err error) []byte {
+	if err != nil {
+		return nil
+	}
+	return append([]byte(nil), c.tree.RootHash()...)
+}
+
+/*
+Verifies proof for leafData against the current root of the tree.
+Accepts
+  - data of the leaf
+  - proof of the leaf
+
+Returns
+  - true if the proof leads to the current root
+  - *ProofError if proof is malformed or doesn't lead to the root, error from hash function otherwise
+*/
+func (c *ConcurrentTree) VerifyProof(leafData []byte, proof *Proof) (bool, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return verifyProof(c.tree.RootHash(), leafData, proof, c.tree.HashFunc, &c.tree.config)
+}
+
+/*
+Calls fn with the tree holding the shared lock, for reads not covered by other methods such as GetNodes or WriteTo.
+fn must not modify the tree or keep it after returning.
+*/
+func (c *ConcurrentTree) View(fn func(tree *MerkleTree) error) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return fn(c.tree)
+}
+
+/*
+Calls fn with the tree holding the exclusive lock, for changes made of several steps that readers must not see halfway.
+fn must not keep the tree after returning.
+*/
+func (c *ConcurrentTree) Update(fn func(tree *MerkleTree) error) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return fn(c.tree)
+}
+
+/*
+Same as MerkleTree.AppendLeaf.
+*/
+func (c *ConcurrentTree) AppendLeaf(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.AppendLeaf(data)
+}
+
+/*
+Same as MerkleTree.UpdateLeaf.
+*/
+func (c *ConcurrentTree) UpdateLeaf(oldValue *[]byte, newValue *[]byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.UpdateLeaf(oldValue, newValue)
+}
+
+/*
+Same as MerkleTree.UpdateLeafAt.
+*/
+func (c *ConcurrentTree) UpdateLeafAt(index int, newValue []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.UpdateLeafAt(index, newValue)
+}
+
+/*
+Same as MerkleTree.RemoveLeaf.
+*/
+func (c *ConcurrentTree) RemoveLeaf(data []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.RemoveLeaf(data)
+}
+
+/*
+Same as MerkleTree.RemoveLeafAt.
+*/
+func (c *ConcurrentTree) RemoveLeafAt(index int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.RemoveLeafAt(index)
+}
+
+/*
+Same as MerkleTree.Prune.
+*/
+func (c *ConcurrentTree) Prune(count int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.tree.Prune(count)
+}
@@ -0,0 +1,266 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func appendedData(i int) []byte {
+	return []byte(fmt.Sprintf("Appended%d", i))
+}
+
+func TestConcurrentTreeMixedLoad(t *testing.T) {
+	const initial, stable, readers, reads = 64, 32, 8, 300
+	for _, test := range []struct {
+		opts  []Option
+		store bool
+	}{
+		{nil, false},
+		{[]Option{WithDomainSeparation(), WithOddNodePromotion()}, false},
+		{[]Option{WithBranching(4)}, false},
+		{[]Option{WithDomainSeparation()}, true},
+	} {
+		data := testData(initial)
+		opts := test.opts
+		if test.store {
+			opts = append([]Option{WithNodeStore(NewMemoryNodeStore())}, opts...)
+		}
+		tree, err := NewTree(&data, HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		c, err := NewConcurrentTree(tree)
+		if err != nil {
+			t.Fatalf("Failed to wrap tree due to error %v", err)
+		}
+
+		//Writers keep going until all readers are done, so that every read overlaps with writes
+		var readersDone, writersDone sync.WaitGroup
+		done := make(chan struct{})
+		errs := make(chan error, readers+2)
+		appended := 0
+		writersDone.Add(2)
+		go func() {
+			defer writersDone.Done()
+			for ; ; appended++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := c.AppendLeaf(appendedData(appended)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		//Leaves before stable are never updated, so readers know their data
+		go func() {
+			defer writersDone.Done()
+			random := rand.New(rand.NewSource(1))
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				index := stable + random.Intn(initial-stable)
+				data[index] = []byte(fmt.Sprintf("Updated%d", i))
+				if err := c.UpdateLeafAt(index, data[index]); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+		for r := 0; r < readers; r++ {
+			readersDone.Add(1)
+			go func(seed int64) {
+				defer readersDone.Done()
+				errs <- readConcurrently(c, data[:stable], initial, reads, seed, test.opts)
+			}(int64(r))
+		}
+		readersDone.Wait()
+		close(done)
+		writersDone.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("Concurrent access failed with options %d, store %v: %v", len(test.opts), test.store, err)
+			}
+		}
+
+		for i := 0; i < appended; i++ {
+			data = append(data, appendedData(i))
+		}
+		expected, _ := NewTree(&data, HashFuncSHA256, test.opts...)
+		if !bytes.Equal(c.RootHash(), expected.RootHash()) || c.LeafCount() != len(data) {
+			t.Fatalf("Tree doesn't match tree built from final data after concurrent writes")
+		}
+	}
+}
+
+/*
+Proves random leaves whose data is known while the tree is written, checking every proof against the root returned with it.
+Leaves before len(stable) hold stable, appended leaves start at initial.
+*/
+func readConcurrently(c *ConcurrentTree, stable Data, initial int, reads int, seed int64, opts []Option) error {
+	random := rand.New(rand.NewSource(seed))
+	config := newTreeConfig(opts)
+	binary := config.arity() == 2
+	for i := 0; i < reads; i++ {
+		var index int
+		var leaf []byte
+		if count := c.LeafCount(); count > initial && random.Intn(2) == 0 {
+			index = initial + random.Intn(count-initial)
+			leaf = appendedData(index - initial)
+		} else {
+			index = random.Intn(len(stable))
+			leaf = stable[index]
+		}
+
+		var proof *Proof
+		var root []byte
+		var err error
+		if i%2 == 0 {
+			proof, root, err = c.GenerateMerkleProofByIndex(index)
+		} else {
+			proof, root, err = c.GenerateMerkleProof(&leaf)
+		}
+		if err != nil {
+			return fmt.Errorf("proof of leaf %d: %v", index, err)
+		}
+		if _, err := VerifyProof(root, leaf, proof, HashFuncSHA256, opts...); err != nil {
+			return fmt.Errorf("proof of leaf %d doesn't lead to its root: %v", index, err)
+		}
+
+		if binary && index != 0 && i%10 == 0 {
+			multiproof, root, err := c.GenerateMultiProof([]int{0, index})
+			if err != nil {
+				return fmt.Errorf("multiproof of leaves 0 and %d: %v", index, err)
+			}
+			if _, err := VerifyMultiProof(root, [][]byte{stable[0], leaf}, multiproof, HashFuncSHA256, opts...); err != nil {
+				return fmt.Errorf("multiproof of leaves 0 and %d doesn't lead to its root: %v", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+func TestConcurrentTreePruneWindow(t *testing.T) {
+	const window = 16
+	data := Data{appendedData(0)}
+	tree, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	c, _ := NewConcurrentTree(tree)
+
+	var readersDone, writerDone sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, 5)
+	count := 1
+	writerDone.Add(1)
+	go func() {
+		defer writerDone.Done()
+		for ; ; count++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			//Appending and pruning is a single step for readers
+			err := c.Update(func(tree *MerkleTree) error {
+				if err := tree.AppendLeaf(appendedData(count)); err != nil {
+					return err
+				}
+				if count >= window {
+					return tree.Prune(count + 1 - window)
+				}
+				return nil
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		readersDone.Add(1)
+		go func() {
+			defer readersDone.Done()
+			for i := 0; i < 200; i++ {
+				var index int
+				var proof *Proof
+				var root []byte
+				//Leaves in the window are never pruned
+				err := c.View(func(tree *MerkleTree) error {
+					index = tree.LeafCount() - 1 - i%window
+					if index < 0 {
+						index = 0
+					}
+					var err error
+					proof, err = tree.GenerateMerkleProofByIndex(index)
+					root = tree.RootHash()
+					return err
+				})
+				if err == nil {
+					_, err = VerifyProof(root, appendedData(index), proof, HashFuncSHA256, WithOddNodePromotion())
+				}
+				if err != nil {
+					errs <- fmt.Errorf("leaf %d: %v", index, err)
+					return
+				}
+			}
+		}()
+	}
+	readersDone.Wait()
+	close(done)
+	writerDone.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Concurrent access with pruning failed: %v", err)
+	}
+	if c.LeafCount() != count || c.PrunedCount() != count-window {
+		t.Fatalf("Expected %d leaves with all but %d pruned, got %d leaves", count, window, c.LeafCount())
+	}
+}
+
+func TestConcurrentTreeLazyLevels(t *testing.T) {
+	data := testData(100)
+	tree, _ := NewTreeWithHash(&data, SHA256)
+	var buf bytes.Buffer
+	tree.WriteSnapshot(&buf, 0)
+	loaded, err := ReadTree(&buf, WithLazyLevels())
+	if err != nil {
+		t.Fatalf("Failed to read snapshot due to error %v", err)
+	}
+	//Levels and the leaf index are built before readers share the tree
+	c, err := NewConcurrentTree(loaded)
+	if err != nil || loaded.levels == nil || loaded.leafIndex == nil {
+		t.Fatalf("Expected levels and leaf index to be built, error %v", err)
+	}
+
+	var wg sync.WaitGroup
+	failed := make(chan int, len(data))
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r; i < len(data); i += 4 {
+				proof, root, err := c.GenerateMerkleProof(&data[i])
+				if err != nil || !bytes.Equal(root, tree.RootHash()) {
+					failed <- i
+					continue
+				}
+				if ok, _ := c.VerifyProof(data[i], proof); !ok {
+					failed <- i
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(failed)
+	for i := range failed {
+		t.Fatalf("Failed to prove leaf %d of lazily loaded tree", i)
+	}
+}
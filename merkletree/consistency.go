@@ -0,0 +1,181 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+)
+
+/*
+Proof that the tree with OldSize leaves is a prefix of the tree with NewSize leaves, as described in RFC 6962 section 2.1.2.
+*/
+type ConsistencyProof struct {
+	OldSize int
+	NewSize int
+	Hashes  [][]byte
+}
+
+/*
+Generates a consistency proof between two sizes of the tree.
+Only trees built using WithOddNodePromotion have the shape defined by RFC 6962, other trees return an error.
+Accepts
+  - number of leaves in the older tree
+  - number of leaves in the newer tree, at most the current leaf count
+
+Returns
+  - Reference to a ConsistencyProof object
+  - error in case sizes are invalid or the tree has a different shape
+*/
+func (t *MerkleTree) GenerateConsistencyProof(oldSize int, newSize int) (*ConsistencyProof, error) {
+	if !t.config.promoteOddNodes {
+		return nil, fmt.Errorf("%w: consistency proofs require a tree built using WithOddNodePromotion", ErrUnsupported)
+	}
+	if err := t.requireBinary("consistency proofs"); err != nil {
+		return nil, err
+	}
+	if oldSize <= 0 || oldSize > newSize || newSize > t.LeafCount() {
+		return nil, fmt.Errorf("%w: invalid tree sizes %d and %d for tree with %d leaves", ErrIndexOutOfRange, oldSize, newSize, t.LeafCount())
+	}
+	proof := ConsistencyProof{OldSize: oldSize, NewSize: newSize}
+	var err error
+	proof.Hashes, err = t.subProof(oldSize, 0, newSize, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+/*
+Implements SUBPROOF(m, D[start:end], b) from RFC 6962 section 2.1.2.
+*/
+func (t *MerkleTree) subProof(m int, start int, end int, complete bool, hashes [][]byte) ([][]byte, error) {
+	size := end - start
+	if m == size {
+		if complete {
+			return hashes, nil
+		}
+		hash, err := t.rangeHash(start, end)
+		return append(hashes, hash), err
+	}
+	k := largestPowerOf2Below(size)
+	var err error
+	var hash []byte
+	if m <= k {
+		if hashes, err = t.subProof(m, start, start+k, complete, hashes); err != nil {
+			return nil, err
+		}
+		hash, err = t.rangeHash(start+k, end)
+	} else {
+		if hashes, err = t.subProof(m-k, start+k, end, false, hashes); err != nil {
+			return nil, err
+		}
+		hash, err = t.rangeHash(start, start+k)
+	}
+	return append(hashes, hash), err
+}
+
+/*
+Returns the hash of the tree built from leaves [start, end), using stored nodes when they cover exactly that range.
+*/
+func (t *MerkleTree) rangeHash(start int, end int) ([]byte, error) {
+	size := end - start
+	level := bits.Len(uint(size - 1))
+	//Node at level l and index i covers leaves [i*2^l, min((i+1)*2^l, leafCount))
+	coverEnd := start + 1<<level
+	if coverEnd > t.LeafCount() {
+		coverEnd = t.LeafCount()
+	}
+	if start%(1<<level) == 0 && coverEnd == end {
+		return t.nodeHash(level, start>>level)
+	}
+	k := largestPowerOf2Below(size)
+	left, err := t.rangeHash(start, start+k)
+	if err != nil {
+		return nil, err
+	}
+	right, err := t.rangeHash(start+k, end)
+	if err != nil {
+		return nil, err
+	}
+	return t.hashNode(left, right)
+}
+
+func largestPowerOf2Below(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+/*
+Verifies that oldRoot is the root of a prefix of the tree with root newRoot, following RFC 9162 section 2.1.4.2.
+Options should be the same ones the tree was built with.
+Accepts
+  - trusted root hash of the older tree
+  - trusted root hash of the newer tree
+  - ConsistencyProof object between the two trees
+  - Hash function the trees were built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed or doesn't lead to the roots, ErrUnsupported if options select a k-ary tree,
+    error from hash function otherwise
+*/
+func VerifyConsistencyProof(oldRoot []byte, newRoot []byte, proof *ConsistencyProof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config := newTreeConfig(opts)
+	if err := config.requireBinary("consistency proofs"); err != nil {
+		return false, err
+	}
+	if proof == nil || proof.OldSize <= 0 || proof.OldSize > proof.NewSize {
+		return false, &ProofError{Err: ErrMalformedProof, Detail: "invalid tree sizes in consistency proof"}
+	}
+	if proof.OldSize == proof.NewSize {
+		if len(proof.Hashes) != 0 {
+			return false, &ProofError{Err: ErrMalformedProof, Detail: "consistency proof between equal sizes must be empty"}
+		}
+		if !bytes.Equal(oldRoot, newRoot) {
+			return false, &ProofError{Err: ErrRootMismatch}
+		}
+		return true, nil
+	}
+	path := proof.Hashes
+	if proof.OldSize&(proof.OldSize-1) == 0 {
+		//Old tree is a complete subtree of the new one, its root is the starting point.
+		path = append([][]byte{oldRoot}, path...)
+	}
+	if len(path) == 0 {
+		return false, &ProofError{Err: ErrMalformedProof, Detail: "consistency proof is empty"}
+	}
+	fn, sn := proof.OldSize-1, proof.NewSize-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	oldHash, newHash := path[0], path[0]
+	var err error
+	for _, hash := range path[1:] {
+		if sn == 0 {
+			return false, &ProofError{Err: ErrMalformedProof, Detail: "consistency proof has too many hashes"}
+		}
+		if fn&1 == 1 || fn == sn {
+			if oldHash, err = config.hashNode(hashFunc, hash, oldHash); err != nil {
+				return false, err
+			}
+			if newHash, err = config.hashNode(hashFunc, hash, newHash); err != nil {
+				return false, err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else if newHash, err = config.hashNode(hashFunc, newHash, hash); err != nil {
+			return false, err
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return false, &ProofError{Err: ErrMalformedProof, Detail: "consistency proof has too few hashes"}
+	}
+	if !bytes.Equal(oldHash, oldRoot) || !bytes.Equal(newHash, newRoot) {
+		return false, &ProofError{Err: ErrRootMismatch}
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package merkletree
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Consistency proofs from the Certificate Transparency reference implementation tests.
+var ctConsistencyProofs = []struct {
+	oldSize, newSize int
+	hashes           []string
+}{
+	{1, 1, nil},
+	{1, 8, []string{
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+	}},
+	{6, 8, []string{
+		"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+		"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	}},
+	{2, 5, []string{
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+	}},
+}
+
+func TestConsistencyProofCTVectors(t *testing.T) {
+	data := ctData(t, len(ctLeaves))
+	tree, err := NewTree(&data, HashFuncSHA256, WithDomainSeparation(), WithOddNodePromotion())
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	for _, vector := range ctConsistencyProofs {
+		proof, err := tree.GenerateConsistencyProof(vector.oldSize, vector.newSize)
+		if err != nil {
+			t.Fatalf("Failed to generate consistency proof due to error %v", err)
+		}
+		if len(proof.Hashes) != len(vector.hashes) {
+			t.Fatalf("Consistency proof %d to %d has %d hashes, expected %d",
+				vector.oldSize, vector.newSize, len(proof.Hashes), len(vector.hashes))
+		}
+		for i, expected := range vector.hashes {
+			if hex.EncodeToString(proof.Hashes[i]) != expected {
+				t.Fatalf("Hash %d of consistency proof %d to %d is %x, expected %s",
+					i, vector.oldSize, vector.newSize, proof.Hashes[i], expected)
+			}
+		}
+		verified, err := VerifyConsistencyProof(ctRoot(t, vector.oldSize), ctRoot(t, vector.newSize), proof,
+			HashFuncSHA256, WithDomainSeparation())
+		if !verified {
+			t.Fatalf("Failed to verify consistency proof %d to %d due to error %v", vector.oldSize, vector.newSize, err)
+		}
+	}
+}
+
+func TestConsistencyProofAllSizes(t *testing.T) {
+	data := testData(40)
+	tree, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	roots := make([][]byte, len(data)+1)
+	for size := 1; size <= len(data); size++ {
+		prefix := data[:size]
+		prefixTree, _ := NewTree(&prefix, HashFuncSHA256, WithOddNodePromotion())
+		roots[size] = prefixTree.RootHash()
+	}
+	for newSize := 1; newSize <= len(data); newSize++ {
+		for oldSize := 1; oldSize <= newSize; oldSize++ {
+			proof, err := tree.GenerateConsistencyProof(oldSize, newSize)
+			if err != nil {
+				t.Fatalf("Failed to generate consistency proof due to error %v", err)
+			}
+			if verified, err := VerifyConsistencyProof(roots[oldSize], roots[newSize], proof, HashFuncSHA256); !verified {
+				t.Fatalf("Failed to verify consistency proof %d to %d due to error %v", oldSize, newSize, err)
+			}
+			if oldSize == newSize {
+				continue
+			}
+			if verified, err := VerifyConsistencyProof(roots[oldSize], roots[newSize-1], proof, HashFuncSHA256); verified || err == nil {
+				t.Fatalf("Expected consistency proof %d to %d to fail against root of size %d", oldSize, newSize, newSize-1)
+			}
+			if len(proof.Hashes) > 0 {
+				proof.Hashes = proof.Hashes[1:]
+				if verified, _ := VerifyConsistencyProof(roots[oldSize], roots[newSize], proof, HashFuncSHA256); verified {
+					t.Fatalf("Expected truncated consistency proof %d to %d to fail", oldSize, newSize)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistencyProofInvalid(t *testing.T) {
+	data := testData(6)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	if _, err := tree.GenerateConsistencyProof(3, 6); err == nil {
+		t.Fatalf("Expected error generating consistency proof for duplicate padded tree")
+	}
+	tree, _ = NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	for _, sizes := range [][2]int{{0, 6}, {4, 3}, {3, 7}} {
+		if _, err := tree.GenerateConsistencyProof(sizes[0], sizes[1]); err == nil {
+			t.Fatalf("Expected error generating consistency proof for sizes %v", sizes)
+		}
+	}
+	proof, _ := tree.GenerateConsistencyProof(3, 6)
+	proof.OldSize = 0
+	if verified, err := VerifyConsistencyProof(tree.RootHash(), tree.RootHash(), proof, HashFuncSHA256); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for invalid size, got %t, %v", verified, err)
+	}
+	if verified, err := VerifyConsistencyProof(tree.RootHash(), tree.RootHash(), nil, HashFuncSHA256); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for nil proof, got %t, %v", verified, err)
+	}
+	appended, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	appended.AppendLeaf([]byte("appended"))
+	proof, _ = appended.GenerateConsistencyProof(6, 7)
+	if verified, err := VerifyConsistencyProof(tree.RootHash(), appended.RootHash(), proof, HashFuncSHA256); !verified {
+		t.Fatalf("Failed to verify consistency proof after append due to error %v", err)
+	}
+	if verified, err := VerifyConsistencyProof(tree.RootHash(), appended.RootHash(), proof, HashFuncSHA256, WithBranching(4)); verified || !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported verifying consistency proof as a 4-ary tree, got %t, %v", verified, err)
+	}
+}
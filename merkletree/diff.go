@@ -0,0 +1,159 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+Source of node hashes of a tree, addressed by level, 0 being the leaves, and index within the level.
+A MerkleTree is a NodeSource. Remote replicas can be diffed by implementing it on top of a request/response protocol,
+each GetNodes call is a single round trip.
+*/
+type NodeSource interface {
+	//Returns number of leaves in the tree
+	LeafCount() int
+	//Returns number of children of each non-leaf node, 2 for a binary tree
+	Branching() int
+	//Returns hashes of the nodes at the given indexes of level, in the same order
+	GetNodes(level int, indexes []int) ([][]byte, error)
+}
+
+/*
+Returns hashes of the nodes at the given indexes of level.
+Accepts
+  - level of the nodes, 0 being the leaves
+  - indexes of the nodes within the level
+
+Returns
+  - node hashes in the same order as indexes
+  - error in case any position is out of range or the node store fails
+*/
+func (t *MerkleTree) GetNodes(level int, indexes []int) ([][]byte, error) {
+	if level < 0 || level > t.Depth {
+		return nil, fmt.Errorf("%w: level %d not in [0, %d]", ErrIndexOutOfRange, level, t.Depth)
+	}
+	size, k := t.LeafCount(), t.config.arity()
+	for l := 0; l < level; l++ {
+		size = (size + k - 1) / k
+	}
+	hashes := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		if index < 0 || index >= size {
+			return nil, fmt.Errorf("%w: node index %d not in [0, %d) at level %d", ErrIndexOutOfRange, index, size, level)
+		}
+		hash, err := t.nodeHash(level, index)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return hashes, nil
+}
+
+/*
+Returns the number of children of each non-leaf node, 2 unless the tree is built using WithBranching.
+*/
+func (t *MerkleTree) Branching() int {
+	return t.config.arity()
+}
+
+/*
+Finds the positions of leaves that differ between two trees built with the same options.
+Walks down from the root and skips subtrees whose hashes match, so it is cheap when few leaves differ.
+If leaf counts differ, leaves are compared one by one and positions present in only one tree are reported as differing.
+Nodes that can't be read from a NodeStore are considered differing, use DiffNodes to get such errors instead.
+Accepts
+  - trees to compare
+
+Returns
+  - positions of differing leaves in ascending order, nil if trees are equal
+*/
+func Diff(a *MerkleTree, b *MerkleTree) []int {
+	if a.LeafCount() != b.LeafCount() || a.config.arity() != b.config.arity() {
+		return diffLeaves(a, b)
+	}
+	diff, _ := diffNodes(a, b, a.config.arity(), false)
+	return diff
+}
+
+/*
+Finds the positions of leaves that differ between two trees with the same leaf count, branching factor and options,
+fetching hashes one level at a time so that it takes at most depth+1 GetNodes calls on each source.
+Accepts
+  - sources of the trees to compare, e.g. a local MerkleTree and a client of a remote replica
+
+Returns
+  - positions of differing leaves in ascending order, nil if trees are equal
+  - ErrShapeMismatch in case leaf counts or branching factors differ, error from either source otherwise
+*/
+func DiffNodes(local NodeSource, remote NodeSource) ([]int, error) {
+	if local.LeafCount() != remote.LeafCount() {
+		return nil, fmt.Errorf("%w: %d and %d leaves", ErrShapeMismatch, local.LeafCount(), remote.LeafCount())
+	}
+	k := local.Branching()
+	if k != remote.Branching() {
+		return nil, fmt.Errorf("%w: branching factors %d and %d", ErrShapeMismatch, k, remote.Branching())
+	}
+	if k < 2 {
+		return nil, fmt.Errorf("%w: branching factor %d", ErrUnsupported, k)
+	}
+	return diffNodes(local, remote, k, true)
+}
+
+/*
+Walks down both trees from the root, k being the number of children of each non-leaf node.
+*/
+func diffNodes(a NodeSource, b NodeSource, k int, strict bool) ([]int, error) {
+	//Size of each level, upto the level holding only the root
+	sizes := []int{a.LeafCount()}
+	for sizes[len(sizes)-1] > 1 {
+		sizes = append(sizes, (sizes[len(sizes)-1]+k-1)/k)
+	}
+	var diff []int
+	candidates := []int{0}
+	for level := len(sizes) - 1; len(candidates) > 0; level-- {
+		hashesA, errA := a.GetNodes(level, candidates)
+		hashesB, errB := b.GetNodes(level, candidates)
+		if strict && errA != nil {
+			return nil, errA
+		}
+		if strict && errB != nil {
+			return nil, errB
+		}
+		var next []int
+		for i, index := range candidates {
+			if errA == nil && errB == nil && bytes.Equal(hashesA[i], hashesB[i]) {
+				continue
+			}
+			if level == 0 {
+				diff = append(diff, index)
+				continue
+			}
+			for child := k * index; child < k*(index+1) && child < sizes[level-1]; child++ {
+				next = append(next, child)
+			}
+		}
+		candidates = next
+	}
+	return diff, nil
+}
+
+func diffLeaves(a *MerkleTree, b *MerkleTree) []int {
+	common, total := a.LeafCount(), b.LeafCount()
+	if common > total {
+		common, total = total, common
+	}
+	var diff []int
+	for i := 0; i < common; i++ {
+		hashA, errA := a.nodeHash(0, i)
+		hashB, errB := b.nodeHash(0, i)
+		if errA != nil || errB != nil || !bytes.Equal(hashA, hashB) {
+			diff = append(diff, i)
+		}
+	}
+	for i := common; i < total; i++ {
+		diff = append(diff, i)
+	}
+	return diff
+}
@@ -0,0 +1,101 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// NodeSource counting the calls made to it, standing in for a remote replica.
+type countingSource struct {
+	NodeSource
+	calls int
+}
+
+func (s *countingSource) GetNodes(level int, indexes []int) ([][]byte, error) {
+	s.calls++
+	return s.NodeSource.GetNodes(level, indexes)
+}
+
+func TestDiff(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}} {
+		for _, count := range []int{1, 2, 7, 16, 33} {
+			for _, changed := range [][]int{nil, {0}, {count - 1}, {0, count / 2, count - 1}} {
+				data := testData(count)
+				local, _ := NewTree(&data, HashFuncSHA256, opts...)
+				remoteData := append(Data(nil), data...)
+				var expected []int
+				for _, i := range changed {
+					if len(expected) == 0 || expected[len(expected)-1] != i {
+						expected = append(expected, i)
+					}
+					remoteData[i] = []byte(fmt.Sprintf("Changed%d", i))
+				}
+				remote, _ := NewTree(&remoteData, HashFuncSHA256, append([]Option{WithNodeStore(NewMemoryNodeStore())}, opts...)...)
+
+				if diff := Diff(local, remote); !reflect.DeepEqual(diff, expected) {
+					t.Fatalf("Diff of %d leaves returned %v, expected %v", count, diff, expected)
+				}
+				source := countingSource{NodeSource: remote}
+				diff, err := DiffNodes(local, &source)
+				if err != nil {
+					t.Fatalf("Failed to diff due to error %v", err)
+				}
+				if !reflect.DeepEqual(diff, expected) {
+					t.Fatalf("DiffNodes of %d leaves returned %v, expected %v", count, diff, expected)
+				}
+				if source.calls > local.Depth+1 {
+					t.Fatalf("DiffNodes made %d calls for a tree of depth %d", source.calls, local.Depth)
+				}
+			}
+		}
+	}
+}
+
+func TestDiffLeafCountMismatch(t *testing.T) {
+	data := testData(5)
+	a, _ := NewTree(&data, HashFuncSHA256)
+	longer := append(testData(5), []byte("Extra1"), []byte("Extra2"))
+	longer[1] = []byte("Changed")
+	b, _ := NewTree(&longer, HashFuncSHA256)
+	if diff := Diff(a, b); !reflect.DeepEqual(diff, []int{1, 5, 6}) {
+		t.Fatalf("Diff returned %v, expected [1 5 6]", diff)
+	}
+	if _, err := DiffNodes(a, b); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatalf("Expected ErrShapeMismatch diffing trees with different leaf counts, got %v", err)
+	}
+	if _, err := a.GetNodes(0, []int{5}); err == nil {
+		t.Fatalf("Expected error getting node out of range")
+	}
+}
+
+func TestDiffNodesBranching(t *testing.T) {
+	for _, opts := range [][]Option{{WithBranching(4)}, {WithBranching(3), WithOddNodePromotion()}} {
+		data := testData(50)
+		local, _ := NewTree(&data, HashFuncSHA256, opts...)
+		remoteData := append(Data(nil), data...)
+		expected := []int{0, 17, 18, 49}
+		for _, i := range expected {
+			remoteData[i] = []byte(fmt.Sprintf("Changed%d", i))
+		}
+		remote, _ := NewTree(&remoteData, HashFuncSHA256, opts...)
+		source := countingSource{NodeSource: remote}
+		diff, err := DiffNodes(local, &source)
+		if err != nil {
+			t.Fatalf("Failed to diff due to error %v", err)
+		}
+		if !reflect.DeepEqual(diff, expected) {
+			t.Fatalf("DiffNodes of %d-ary trees returned %v, expected %v", local.Branching(), diff, expected)
+		}
+		if source.calls > local.Depth+1 {
+			t.Fatalf("DiffNodes made %d calls for a tree of depth %d", source.calls, local.Depth)
+		}
+	}
+	data := testData(50)
+	binary, _ := NewTree(&data, HashFuncSHA256)
+	kary, _ := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	if _, err := DiffNodes(binary, kary); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatalf("Expected ErrShapeMismatch diffing binary and 4-ary trees, got %v", err)
+	}
+}
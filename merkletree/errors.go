@@ -0,0 +1,61 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	//Proof is structurally invalid, e.g. number of hashes and indexes differ.
+	ErrMalformedProof = errors.New("malformed proof")
+	//Root computed from the proof doesn't match the expected root.
+	ErrRootMismatch = errors.New("generated root hash not matches stored root")
+	//Data, key or leaf hash looked up is not present in the tree.
+	ErrLeafNotFound = errors.New("data doesn't exist in the tree")
+	//Hash function generates less than 128 bits.
+	ErrInsecureHash = errors.New("hash function is not secure enough, require a min 128 bit output to be generated")
+	//Tree can't be built or opened without any leaves, left without any, or nothing is passed to prove.
+	ErrEmptyData = errors.New("cannot build a merkle tree without any data")
+	//Leaf or node position is outside the tree.
+	ErrIndexOutOfRange = errors.New("index out of range")
+	//NodeStore doesn't hold a node at the requested position.
+	ErrNodeNotFound = errors.New("node not found in store")
+	//Content of a FileNodeStore can't be decoded, or a stored root doesn't match the nodes below it.
+	ErrCorruptedStore = errors.New("corrupted node store")
+	//Tree snapshot is truncated, fails its checksum or doesn't lead to its root.
+	ErrCorruptedSnapshot = errors.New("corrupted tree snapshot")
+	//Leaf or node is part of a subtree collapsed by Prune, or the leaf can no longer be modified.
+	ErrPruned = errors.New("leaf has been pruned")
+	//Operation isn't supported by the tree or store, or by the options it is built with.
+	ErrUnsupported = errors.New("unsupported operation")
+	//Trees compared by DiffNodes differ in leaf count or branching factor, so their nodes can't be matched by position.
+	ErrShapeMismatch = errors.New("trees have different shapes")
+)
+
+/*
+Error returned when a proof fails verification.
+Err is one of ErrMalformedProof or ErrRootMismatch and can be matched using errors.Is.
+For ErrRootMismatch, Level is the height above the leaf of the first hash computed from the proof that is wrong.
+Verifying against a tree finds the exact level, 0 meaning the data itself is not in the tree.
+Verifying against a root hash alone can only tell that the root differs, so Level is the number of proof hashes.
+*/
+type ProofError struct {
+	Err    error
+	Detail string
+	Level  int
+}
+
+func (e *ProofError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *ProofError) Unwrap() error {
+	return e.Err
+}
+
+func malformedProof(format string, args ...interface{}) *ProofError {
+	return &ProofError{Err: ErrMalformedProof, Detail: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,103 @@
+package merkletree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	weakHash := func(data []byte) ([]byte, error) {
+		return make([]byte, 8), nil
+	}
+	data := testData(5)
+	if _, err := NewTree(&data, weakHash); !errors.Is(err, ErrInsecureHash) {
+		t.Fatalf("Expected ErrInsecureHash, got %v", err)
+	}
+	if _, err := NewTree(&Data{}, HashFuncSHA256); !errors.Is(err, ErrEmptyData) {
+		t.Fatalf("Expected ErrEmptyData, got %v", err)
+	}
+	if _, err := OpenTree(NewMemoryNodeStore(), HashFuncSHA256); !errors.Is(err, ErrEmptyData) {
+		t.Fatalf("Expected ErrEmptyData opening an empty store, got %v", err)
+	}
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	missing := []byte("Missing")
+	if _, err := tree.GenerateMerkleProof(&missing); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected ErrLeafNotFound, got %v", err)
+	}
+	if err := tree.UpdateLeaf(&missing, &missing); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected ErrLeafNotFound, got %v", err)
+	}
+	if err := tree.RemoveLeaf(missing); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected ErrLeafNotFound, got %v", err)
+	}
+	if _, err := tree.GenerateMerkleProofByIndex(5); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if _, err := tree.GenerateMultiProof([]int{-1}); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+	if _, err := NewMemoryNodeStore().GetNode(0, 0); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("Expected ErrNodeNotFound, got %v", err)
+	}
+	sparse, _ := NewSparseTree(HashFuncSHA256)
+	if _, err := sparse.Get(sparseKey(1)); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected ErrLeafNotFound for sparse key, got %v", err)
+	}
+	if _, err := tree.GenerateMultiProof(nil); !errors.Is(err, ErrEmptyData) {
+		t.Fatalf("Expected ErrEmptyData for multiproof of no leaves, got %v", err)
+	}
+	if _, err := tree.GenerateConsistencyProof(2, 4); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for consistency proof without odd node promotion, got %v", err)
+	}
+	promoted, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	if _, err := promoted.GenerateConsistencyProof(4, 2); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange for invalid consistency proof sizes, got %v", err)
+	}
+	single, _ := NewTree(&Data{data[0]}, HashFuncSHA256)
+	if err := single.RemoveLeafAt(0); !errors.Is(err, ErrEmptyData) {
+		t.Fatalf("Expected ErrEmptyData removing the only leaf, got %v", err)
+	}
+	store := NewMemoryNodeStore()
+	NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if _, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported building in a store holding a tree, got %v", err)
+	}
+	if err := store.PutNode(-1, 0, nil); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange for invalid node position, got %v", err)
+	}
+	if err := sparse.Set([]byte("short"), data[0]); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for short sparse key, got %v", err)
+	}
+	var proof Proof
+	if err := proof.UnmarshalBinary([]byte{ProofEncodingVersion, 1}); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof decoding truncated proof, got %v", err)
+	}
+}
+
+func TestProofErrorLevel(t *testing.T) {
+	data := testData(8)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	for level := 0; level < tree.Depth; level++ {
+		proof, _ := tree.GenerateMerkleProofByIndex(3)
+		proof.Hashes[level] = make([]byte, len(proof.Hashes[level]))
+		verified, err := tree.VerifyProof(&data[3], proof)
+		var proofErr *ProofError
+		if verified || !errors.As(err, &proofErr) || !errors.Is(err, ErrRootMismatch) {
+			t.Fatalf("Expected ProofError with ErrRootMismatch, got %v", err)
+		}
+		if proofErr.Level != level+1 {
+			t.Fatalf("Tampering hash %d reported level %d, expected %d", level, proofErr.Level, level+1)
+		}
+		_, err = VerifyProof(tree.RootHash(), data[3], proof, HashFuncSHA256)
+		if !errors.As(err, &proofErr) || proofErr.Level != tree.Depth {
+			t.Fatalf("Expected root level %d without the tree, got %v", tree.Depth, err)
+		}
+	}
+	proof, _ := tree.GenerateMerkleProofByIndex(3)
+	missing := []byte("Missing")
+	_, err := tree.VerifyProof(&missing, proof)
+	var proofErr *ProofError
+	if !errors.As(err, &proofErr) || proofErr.Level != 0 {
+		t.Fatalf("Expected level 0 for data not in the tree, got %v", err)
+	}
+}
@@ -0,0 +1,670 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+const (
+	fileStoreMagic          = "MKNS"
+	fileStoreVersion   byte = 2
+	fileStoreHeaderLen      = 16
+	fileIndexMagic          = "MKNI"
+	fileLeavesMagic         = "MKNH"
+	fileIndexHeaderLen      = 32
+	//Node positions are limited so that index slot offsets fit in an int64
+	maxSlotBits = 52
+	//Kind byte, level byte and uint64 index preceding the hash of a record
+	recordHeaderLen      = 10
+	recordNode      byte = 1
+	recordCommit    byte = 2
+	minLeafBuckets       = 1024
+)
+
+var fileStoreCRC = crc32.MakeTable(crc32.Castagnoli)
+
+/*
+NodeStore backed by an append-only log of fixed-size records, so that a write never changes what is already on disk.
+Each record holds a node position and its hash, the latest record for a position wins. Trees commit after every operation,
+appending a commit record holding the leaf count, and records after the last commit are dropped when the store is reopened,
+so a crash never leaves part of an operation behind.
+Log header is 4 magic bytes, version byte, hash size byte and 10 reserved bytes. Records are a kind byte, level byte,
+index as uint64 big endian, the hash and a CRC-32C checksum of all of them. All hashes are of the same size,
+set by the first node stored.
+Two index files are kept next to the log, so that only a few counters are held in memory:
+  - path.index holds the offset of the latest record of each node position, at a slot computed from the position:
+    leaf i in slot 2i and the node at index i of level l in slot 2^l*(2i+1)-1, so the slots of a growing tree never move.
+  - path.leaves is an open addressing hash table of leaf positions keyed by leaf hash, used by FindLeaf.
+
+Both are derived from the log. Sync marks them as matching the log, and they are rebuilt from it when the store is reopened
+after writes that weren't synced.
+*/
+type FileNodeStore struct {
+	path   string
+	file   *os.File
+	index  *os.File
+	leaves *os.File
+	size   int64
+	//Part of the log known to be on disk, a record failing its checksum before it is corruption rather than a torn write
+	synced    int64
+	hashSize  int
+	leafCount int
+	buckets   int64
+	entries   int64
+	//Index files have changed since Sync marked them as matching the log
+	dirty bool
+}
+
+/*
+Opens the store at path, creating the file if it doesn't exist, along with its index files at path.index and path.leaves.
+A partially written record at the end of the log, e.g. due to a crash, is discarded along with every record after the last commit.
+Accepts
+  - path of the file
+
+Returns
+  - Reference to the store
+  - error in case the file can't be opened or is corrupted
+*/
+func OpenFileNodeStore(path string) (*FileNodeStore, error) {
+	s := FileNodeStore{path: path}
+	var err error
+	if s.file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		return nil, err
+	}
+	if s.index, err = os.OpenFile(path+".index", os.O_RDWR|os.O_CREATE, 0o644); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return &s, nil
+}
+
+/*
+Reads the log header and loads the index files, rebuilding them from the log unless Sync marked them as matching it.
+*/
+func (s *FileNodeStore) load() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	s.size = info.Size()
+	if s.size < fileStoreHeaderLen {
+		//The header is written along with the first record, so a file torn while writing it holds no nodes
+		prefix := make([]byte, s.size)
+		if _, err := s.file.ReadAt(prefix, 0); err != nil {
+			return err
+		}
+		if !isFileStoreHeaderPrefix(prefix) {
+			return fmt.Errorf("%w: not a node store file", ErrCorruptedStore)
+		}
+		s.size = 0
+		if err := s.file.Truncate(0); err != nil {
+			return err
+		}
+		return s.rebuildIndexes()
+	}
+	header := make([]byte, fileStoreHeaderLen)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:4]) != fileStoreMagic {
+		return fmt.Errorf("%w: not a node store file", ErrCorruptedStore)
+	}
+	if header[4] != fileStoreVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrCorruptedStore, header[4])
+	}
+	s.hashSize = int(header[5])
+	if s.hashSize == 0 || s.hashSize > MaxProofHashSize {
+		return fmt.Errorf("%w: hash of %d bytes", ErrCorruptedStore, s.hashSize)
+	}
+
+	synced, checkpoint, clean := s.readIndexHeader()
+	s.synced = synced
+	if !clean || checkpoint != s.size {
+		return s.rebuildIndexes()
+	}
+	//Marked clean only after a commit, but a log synced in the middle of an operation ends with records to drop
+	s.leafCount = 0
+	if s.size > fileStoreHeaderLen {
+		kind, _, count, ok, err := s.readRecord(s.size - s.recordSize())
+		if err != nil {
+			return err
+		}
+		if !ok || kind != recordCommit {
+			return s.rebuildIndexes()
+		}
+		s.leafCount = int(count)
+	}
+	if err := s.openLeaves(); err != nil {
+		return s.rebuildLeaves()
+	}
+	return nil
+}
+
+/*
+Returns true if data is the start of a header, which a write torn while creating the store leaves behind.
+*/
+func isFileStoreHeaderPrefix(data []byte) bool {
+	expected := append([]byte(fileStoreMagic), fileStoreVersion)
+	if len(data) > len(expected) {
+		data = data[:len(expected)]
+	}
+	return bytes.HasPrefix(expected, data)
+}
+
+func (s *FileNodeStore) recordSize() int64 {
+	return int64(recordHeaderLen + s.hashSize + 4)
+}
+
+func (s *FileNodeStore) encodeRecord(kind byte, level int, index int, hash []byte) []byte {
+	record := make([]byte, recordHeaderLen, s.recordSize())
+	record[0] = kind
+	record[1] = byte(level)
+	binary.BigEndian.PutUint64(record[2:], uint64(index))
+	if hash == nil {
+		hash = make([]byte, s.hashSize)
+	}
+	record = append(record, hash...)
+	return binary.BigEndian.AppendUint32(record, crc32.Checksum(record, fileStoreCRC))
+}
+
+/*
+Reads the record at offset of the log, returning false if it fails its checksum.
+*/
+func (s *FileNodeStore) readRecord(offset int64) (byte, int, uint64, bool, error) {
+	record, ok, err := s.readRawRecord(offset)
+	if err != nil || !ok {
+		return 0, 0, 0, false, err
+	}
+	return record[0], int(record[1]), binary.BigEndian.Uint64(record[2:]), true, nil
+}
+
+func (s *FileNodeStore) readRawRecord(offset int64) ([]byte, bool, error) {
+	record := make([]byte, s.recordSize())
+	if _, err := s.file.ReadAt(record, offset); err != nil {
+		return nil, false, err
+	}
+	sum := len(record) - 4
+	if crc32.Checksum(record[:sum], fileStoreCRC) != binary.BigEndian.Uint32(record[sum:]) {
+		return nil, false, nil
+	}
+	if record[0] != recordNode && record[0] != recordCommit {
+		return nil, false, nil
+	}
+	return record, true, nil
+}
+
+/*
+Drops the records after the last commit and replays the remaining ones into new index files.
+A record failing its checksum after the synced part of the log is a torn write, one before it is reported as corruption.
+*/
+func (s *FileNodeStore) rebuildIndexes() error {
+	committed, leafCount := int64(0), 0
+	if s.size > 0 {
+		committed = fileStoreHeaderLen
+	}
+	for offset := int64(fileStoreHeaderLen); s.size > 0 && offset+s.recordSize() <= s.size; offset += s.recordSize() {
+		kind, _, index, ok, err := s.readRecord(offset)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if offset < s.synced {
+				return fmt.Errorf("%w: record at offset %d fails its checksum", ErrCorruptedStore, offset)
+			}
+			break
+		}
+		if kind == recordCommit {
+			committed, leafCount = offset+s.recordSize(), int(index)
+		}
+	}
+	if committed < s.size {
+		if err := s.file.Truncate(committed); err != nil {
+			return err
+		}
+		s.size = committed
+	}
+	if s.size == 0 {
+		s.hashSize = 0
+	}
+	s.leafCount = leafCount
+
+	s.dirty = false
+	if err := s.markDirty(); err != nil {
+		return err
+	}
+	if err := s.index.Truncate(fileIndexHeaderLen); err != nil {
+		return err
+	}
+	for offset := int64(fileStoreHeaderLen); offset < s.size; offset += s.recordSize() {
+		kind, level, index, _, err := s.readRecord(offset)
+		if err != nil {
+			return err
+		}
+		if kind == recordNode {
+			if err := s.writeSlot(level, int(index), offset); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.rebuildLeaves(); err != nil {
+		return err
+	}
+	return s.Sync()
+}
+
+/*
+Returns the offset of the index slot of the node at index of level, false if the position can't be stored.
+*/
+func slotOffset(level int, index int) (int64, bool) {
+	if level < 0 || index < 0 || level >= maxSlotBits || index >= 1<<(maxSlotBits-1-level) {
+		return 0, false
+	}
+	slot := int64(index)<<(level+1) + int64(1)<<level - 1
+	return fileIndexHeaderLen + slot*8, true
+}
+
+/*
+Returns offset in the log of the latest record of the node at index of level, 0 if there is none.
+*/
+func (s *FileNodeStore) readSlot(level int, index int) (int64, error) {
+	offset, valid := slotOffset(level, index)
+	if !valid {
+		return 0, nil
+	}
+	slot := make([]byte, 8)
+	if _, err := s.index.ReadAt(slot, offset); err == io.EOF {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(slot)), nil
+}
+
+func (s *FileNodeStore) writeSlot(level int, index int, record int64) error {
+	offset, _ := slotOffset(level, index)
+	slot := binary.BigEndian.AppendUint64(nil, uint64(record))
+	_, err := s.index.WriteAt(slot, offset)
+	return err
+}
+
+func (s *FileNodeStore) GetNode(level int, index int) ([]byte, error) {
+	if level == 0 && index >= s.leafCount {
+		return nil, fmt.Errorf("%w: level %d index %d", ErrNodeNotFound, level, index)
+	}
+	return s.readNode(level, index)
+}
+
+/*
+Returns hash of the latest record for the node at index of level, including leaves past the leaf count.
+*/
+func (s *FileNodeStore) readNode(level int, index int) ([]byte, error) {
+	offset, err := s.readSlot(level, index)
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 || s.hashSize == 0 {
+		return nil, fmt.Errorf("%w: level %d index %d", ErrNodeNotFound, level, index)
+	}
+	if offset < fileStoreHeaderLen || offset+s.recordSize() > s.size {
+		return nil, fmt.Errorf("%w: index points past the log at level %d index %d", ErrCorruptedStore, level, index)
+	}
+	record, ok, err := s.readRawRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || record[0] != recordNode || int(record[1]) != level || binary.BigEndian.Uint64(record[2:]) != uint64(index) {
+		return nil, fmt.Errorf("%w: record of level %d index %d doesn't match the index", ErrCorruptedStore, level, index)
+	}
+	return record[recordHeaderLen : recordHeaderLen+s.hashSize], nil
+}
+
+func (s *FileNodeStore) PutNode(level int, index int, hash []byte) error {
+	if _, valid := slotOffset(level, index); !valid {
+		return fmt.Errorf("%w: invalid node position level %d index %d", ErrIndexOutOfRange, level, index)
+	}
+	if s.hashSize == 0 {
+		if len(hash) == 0 || len(hash) > MaxProofHashSize {
+			return fmt.Errorf("%w: hash of %d bytes can't be stored", ErrUnsupported, len(hash))
+		}
+		s.hashSize = len(hash)
+	}
+	if len(hash) != s.hashSize {
+		return fmt.Errorf("%w: hash of %d bytes doesn't match store hash size %d", ErrUnsupported, len(hash), s.hashSize)
+	}
+	offset, err := s.append(s.encodeRecord(recordNode, level, index, hash))
+	if err != nil {
+		return err
+	}
+	if err := s.writeSlot(level, index, offset); err != nil {
+		return err
+	}
+	if level == 0 {
+		return s.addLeaf(hash, index)
+	}
+	return nil
+}
+
+/*
+Returns position of the first leaf with the given hash, probing the leaf table from the bucket of the hash.
+*/
+func (s *FileNodeStore) FindLeaf(hash []byte) (int, bool) {
+	if len(hash) != s.hashSize || s.hashSize == 0 || s.buckets == 0 {
+		return 0, false
+	}
+	//Buckets of leaves that have since changed are left in place, so every candidate is checked against the log
+	found := -1
+	bucket := s.bucketOf(hash)
+	for i := int64(0); i < s.buckets; i++ {
+		entry, err := s.readBucket(bucket)
+		if err != nil || entry == 0 {
+			break
+		}
+		if leaf := int(entry - 1); leaf < s.leafCount && (found < 0 || leaf < found) {
+			if stored, err := s.readNode(0, leaf); err == nil && bytes.Equal(stored, hash) {
+				found = leaf
+			}
+		}
+		bucket = (bucket + 1) & (s.buckets - 1)
+	}
+	return found, found >= 0
+}
+
+func (s *FileNodeStore) LeafCount() int {
+	return s.leafCount
+}
+
+/*
+Sets the leaf count, which is recorded by the next Commit.
+*/
+func (s *FileNodeStore) SetLeafCount(count int) error {
+	if count < 0 {
+		return fmt.Errorf("%w: leaf count %d", ErrIndexOutOfRange, count)
+	}
+	s.leafCount = count
+	return nil
+}
+
+/*
+Appends a commit record holding the leaf count, so that reopening the store keeps every node written before it.
+Use Sync to make committed writes durable.
+*/
+func (s *FileNodeStore) Commit() error {
+	if s.hashSize == 0 {
+		//Nothing is stored, so there is nothing to keep
+		return nil
+	}
+	_, err := s.append(s.encodeRecord(recordCommit, 0, s.leafCount, nil))
+	return err
+}
+
+/*
+Appends record to the log, preceded by the header for the first one, and returns its offset. If the write fails,
+whatever part of it was written is truncated, so that a torn record can only ever be at the end of the log.
+*/
+func (s *FileNodeStore) append(record []byte) (int64, error) {
+	if err := s.markDirty(); err != nil {
+		return 0, err
+	}
+	data := record
+	if s.size == 0 {
+		header := make([]byte, fileStoreHeaderLen, fileStoreHeaderLen+len(record))
+		copy(header, fileStoreMagic)
+		header[4] = fileStoreVersion
+		header[5] = byte(s.hashSize)
+		data = append(header, record...)
+	}
+	if _, err := s.file.WriteAt(data, s.size); err != nil {
+		if truncateErr := s.file.Truncate(s.size); truncateErr != nil {
+			return 0, fmt.Errorf("%w, dropping partially written record failed: %v", err, truncateErr)
+		}
+		if s.size == 0 {
+			s.hashSize = 0
+		}
+		return 0, err
+	}
+	s.size += int64(len(data))
+	return s.size - int64(len(record)), nil
+}
+
+func (s *FileNodeStore) bucketOf(hash []byte) int64 {
+	h := fnv.New64a()
+	h.Write(hash)
+	return int64(h.Sum64() & uint64(s.buckets-1))
+}
+
+func (s *FileNodeStore) readBucket(bucket int64) (uint64, error) {
+	entry := make([]byte, 8)
+	if _, err := s.leaves.ReadAt(entry, fileIndexHeaderLen+bucket*8); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(entry), nil
+}
+
+/*
+Adds leaf at index to the leaf table, growing the table once half of its buckets are used.
+*/
+func (s *FileNodeStore) addLeaf(hash []byte, index int) error {
+	if (s.entries+1)*2 > s.buckets {
+		//The new table is filled from the index, which already holds the leaf
+		return s.rebuildLeaves()
+	}
+	return s.insertLeaf(hash, index)
+}
+
+func (s *FileNodeStore) insertLeaf(hash []byte, index int) error {
+	bucket := s.bucketOf(hash)
+	for i := int64(0); i < s.buckets; i++ {
+		entry, err := s.readBucket(bucket)
+		if err != nil {
+			return err
+		}
+		//A bucket left by an earlier hash of the leaf is checked against the log by FindLeaf, so it serves the new hash too
+		if entry == uint64(index)+1 {
+			return nil
+		}
+		if entry == 0 {
+			s.entries++
+			_, err := s.leaves.WriteAt(binary.BigEndian.AppendUint64(nil, uint64(index)+1), fileIndexHeaderLen+bucket*8)
+			return err
+		}
+		bucket = (bucket + 1) & (s.buckets - 1)
+	}
+	return fmt.Errorf("%w: leaf table is full", ErrCorruptedStore)
+}
+
+/*
+Fills a new leaf table with every leaf held by the index, sized for twice as many, and replaces the current table with it.
+*/
+func (s *FileNodeStore) rebuildLeaves() error {
+	count := 0
+	for {
+		offset, err := s.readSlot(0, count)
+		if err != nil {
+			return err
+		}
+		if offset == 0 {
+			break
+		}
+		count++
+	}
+	buckets := int64(minLeafBuckets)
+	for buckets < 4*int64(count) {
+		buckets *= 2
+	}
+	path := s.path + ".leaves"
+	file, err := os.OpenFile(path+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	previous, previousBuckets, previousEntries := s.leaves, s.buckets, s.entries
+	s.leaves, s.buckets, s.entries = file, buckets, 0
+	err = s.fillLeaves(count)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		file.Close()
+		s.leaves, s.buckets, s.entries = previous, previousBuckets, previousEntries
+		return err
+	}
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+func (s *FileNodeStore) fillLeaves(count int) error {
+	if err := s.leaves.Truncate(fileIndexHeaderLen + s.buckets*8); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		hash, err := s.readNode(0, i)
+		if err != nil {
+			return err
+		}
+		if err := s.insertLeaf(hash, i); err != nil {
+			return err
+		}
+	}
+	if err := s.writeLeavesHeader(); err != nil {
+		return err
+	}
+	return s.leaves.Sync()
+}
+
+/*
+Opens the leaf table, failing if it is missing or its header is invalid.
+*/
+func (s *FileNodeStore) openLeaves() error {
+	file, err := os.OpenFile(s.path+".leaves", os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, fileIndexHeaderLen)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		file.Close()
+		return err
+	}
+	buckets := int64(binary.BigEndian.Uint64(header[8:]))
+	info, err := file.Stat()
+	if err != nil || !validIndexHeader(header, fileLeavesMagic) || buckets < minLeafBuckets || buckets&(buckets-1) != 0 ||
+		info.Size() != fileIndexHeaderLen+buckets*8 {
+		file.Close()
+		return fmt.Errorf("%w: invalid leaf table", ErrCorruptedStore)
+	}
+	s.leaves, s.buckets, s.entries = file, buckets, int64(binary.BigEndian.Uint64(header[16:]))
+	return nil
+}
+
+/*
+Returns true if header starts with magic and the current version and holds a valid checksum.
+*/
+func validIndexHeader(header []byte, magic string) bool {
+	return string(header[:4]) == magic && header[4] == fileStoreVersion &&
+		crc32.Checksum(header[:24], fileStoreCRC) == binary.BigEndian.Uint32(header[24:])
+}
+
+func encodeIndexHeader(magic string, flag byte, first int64, second int64) []byte {
+	header := make([]byte, fileIndexHeaderLen)
+	copy(header, magic)
+	header[4] = fileStoreVersion
+	header[5] = flag
+	binary.BigEndian.PutUint64(header[8:], uint64(first))
+	binary.BigEndian.PutUint64(header[16:], uint64(second))
+	binary.BigEndian.PutUint32(header[24:], crc32.Checksum(header[:24], fileStoreCRC))
+	return header
+}
+
+func (s *FileNodeStore) writeLeavesHeader() error {
+	_, err := s.leaves.WriteAt(encodeIndexHeader(fileLeavesMagic, 0, s.buckets, s.entries), 0)
+	return err
+}
+
+/*
+Returns the synced part of the log and the log size the index files match, false if they aren't marked as matching it.
+*/
+func (s *FileNodeStore) readIndexHeader() (int64, int64, bool) {
+	header := make([]byte, fileIndexHeaderLen)
+	if _, err := s.index.ReadAt(header, 0); err != nil || !validIndexHeader(header, fileIndexMagic) {
+		return 0, 0, false
+	}
+	return int64(binary.BigEndian.Uint64(header[8:])), int64(binary.BigEndian.Uint64(header[16:])), header[5] == 1
+}
+
+/*
+Marks the index files as no longer matching the log before they are first changed after Sync,
+so that reopening the store after a crash rebuilds them.
+*/
+func (s *FileNodeStore) markDirty() error {
+	if s.dirty {
+		return nil
+	}
+	if _, err := s.index.WriteAt(encodeIndexHeader(fileIndexMagic, 0, s.synced, 0), 0); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+	s.dirty = true
+	return nil
+}
+
+/*
+Flushes written records to disk and marks the index files as matching the log, so that reopening the store doesn't rebuild them.
+Records written after the last commit are still dropped when the store is reopened.
+*/
+func (s *FileNodeStore) Sync() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.synced = s.size
+	if err := s.writeLeavesHeader(); err != nil {
+		return err
+	}
+	if err := s.leaves.Sync(); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+	if _, err := s.index.WriteAt(encodeIndexHeader(fileIndexMagic, 1, s.synced, s.size), 0); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+/*
+Syncs the store and closes its files.
+*/
+func (s *FileNodeStore) Close() error {
+	err := s.Sync()
+	if closeErr := s.closeFiles(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *FileNodeStore) closeFiles() error {
+	var err error
+	for _, file := range []*os.File{s.file, s.index, s.leaves} {
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	return err
+}
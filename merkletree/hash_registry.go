@@ -0,0 +1,165 @@
+package merkletree
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+	"lukechampine.com/blake3"
+)
+
+/*
+Numeric identifier of a registered hash function, recorded in trees and proofs so that they can tell which algorithm they use.
+0 means the hash function is not known, e.g. a HashFunction passed directly to NewTree.
+*/
+type HashID uint8
+
+const (
+	HashUnknown HashID = iota
+	SHA256
+	SHA512_256
+	SHA3_256
+	Keccak256
+	BLAKE2b256
+	BLAKE3
+)
+
+type registeredHash struct {
+	name    string
+	newHash func() hash.Hash
+}
+
+var (
+	hashRegistryLock sync.RWMutex
+	hashesByID       = map[HashID]registeredHash{}
+	hashesByName     = map[string]HashID{}
+)
+
+func init() {
+	builtin := []struct {
+		id      HashID
+		name    string
+		newHash func() hash.Hash
+	}{
+		{SHA256, "sha256", sha256.New},
+		{SHA512_256, "sha512-256", sha512.New512_256},
+		{SHA3_256, "sha3-256", sha3.New256},
+		{Keccak256, "keccak256", sha3.NewLegacyKeccak256},
+		{BLAKE2b256, "blake2b-256", func() hash.Hash {
+			//Error is only returned for keys longer than 64 bytes
+			h, _ := blake2b.New256(nil)
+			return h
+		}},
+		{BLAKE3, "blake3", func() hash.Hash { return blake3.New(32, nil) }},
+	}
+	for _, b := range builtin {
+		if err := RegisterHash(b.id, b.name, b.newHash); err != nil {
+			panic(err)
+		}
+	}
+}
+
+/*
+Adds a hash function to the registry so that it can be looked up by id and name.
+Accepts
+  - id to be recorded in trees and proofs, must not be HashUnknown
+  - unique name of the hash function
+  - constructor returning a new digest
+
+Returns
+  - error in case id or name is already registered
+*/
+func RegisterHash(id HashID, name string, newHash func() hash.Hash) error {
+	if id == HashUnknown {
+		return fmt.Errorf("%w: hash id %d is reserved", ErrUnsupported, HashUnknown)
+	}
+	hashRegistryLock.Lock()
+	defer hashRegistryLock.Unlock()
+	if existing, found := hashesByID[id]; found {
+		return fmt.Errorf("%w: hash id %d already registered for %s", ErrUnsupported, id, existing.name)
+	}
+	if _, found := hashesByName[name]; found {
+		return fmt.Errorf("%w: hash name %s already registered", ErrUnsupported, name)
+	}
+	hashesByID[id] = registeredHash{name: name, newHash: newHash}
+	hashesByName[name] = id
+	return nil
+}
+
+/*
+Returns id of the hash function registered with name, e.g. "sha256", "sha3-256" or "blake2b-256".
+*/
+func LookupHash(name string) (HashID, error) {
+	hashRegistryLock.RLock()
+	defer hashRegistryLock.RUnlock()
+	id, found := hashesByName[name]
+	if !found {
+		return HashUnknown, fmt.Errorf("%w: no hash function registered with name %s", ErrUnsupported, name)
+	}
+	return id, nil
+}
+
+func (id HashID) String() string {
+	hashRegistryLock.RLock()
+	defer hashRegistryLock.RUnlock()
+	if registered, found := hashesByID[id]; found {
+		return registered.name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(id))
+}
+
+/*
+Returns the constructor of digests of the hash function registered with id.
+*/
+func (id HashID) New() (func() hash.Hash, error) {
+	hashRegistryLock.RLock()
+	defer hashRegistryLock.RUnlock()
+	registered, found := hashesByID[id]
+	if !found {
+		return nil, fmt.Errorf("%w: no hash function registered with id %d", ErrUnsupported, id)
+	}
+	return registered.newHash, nil
+}
+
+/*
+Returns a HashFunction computing the hash function registered with id.
+*/
+func (id HashID) HashFunc() (HashFunction, error) {
+	newHash, err := id.New()
+	if err != nil {
+		return nil, err
+	}
+	return func(data []byte) ([]byte, error) {
+		h := newHash()
+		h.Write(data)
+		return h.Sum(nil), nil
+	}, nil
+}
+
+/*
+Builds a new merkle tree using a registered hash function and records its id in the tree and in proofs generated from it.
+Accepts
+  - data list to be used for building the tree
+  - id of the hash function, e.g. SHA256
+  - Optional settings changing how the tree is built
+
+Returns
+  - Reference to the tree in case of no errors
+  - error in case id is not registered or the tree can't be built
+*/
+func NewTreeWithHash(data *Data, id HashID, opts ...Option) (*MerkleTree, error) {
+	newHash, err := id.New()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := NewTreeWithHasher(data, newHash, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tree.HashID = id
+	return tree, nil
+}
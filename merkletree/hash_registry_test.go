@@ -0,0 +1,89 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRegisteredHashes(t *testing.T) {
+	//Digests of "abc" from the respective specifications
+	vectors := []struct {
+		name   string
+		id     HashID
+		digest string
+	}{
+		{"sha256", SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"sha512-256", SHA512_256, "53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23"},
+		{"sha3-256", SHA3_256, "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+		{"keccak256", Keccak256, "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{"blake2b-256", BLAKE2b256, "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{"blake3", BLAKE3, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	}
+	for _, v := range vectors {
+		id, err := LookupHash(v.name)
+		if err != nil || id != v.id || id.String() != v.name {
+			t.Fatalf("Lookup of %s returned %v, %v", v.name, id, err)
+		}
+		hashFunc, err := id.HashFunc()
+		if err != nil {
+			t.Fatalf("Failed to get hash function %s due to error %v", v.name, err)
+		}
+		digest, _ := hashFunc([]byte("abc"))
+		if hex.EncodeToString(digest) != v.digest {
+			t.Fatalf("Digest of %s is %x, expected %s", v.name, digest, v.digest)
+		}
+	}
+	if _, err := LookupHash("md5"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported looking up unregistered hash, got %v", err)
+	}
+	if _, err := HashID(200).HashFunc(); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for unregistered hash id, got %v", err)
+	}
+	if err := RegisterHash(SHA256, "sha256-copy", sha256.New); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported registering an existing id, got %v", err)
+	}
+	if err := RegisterHash(200, "sha256", sha256.New); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported registering an existing name, got %v", err)
+	}
+}
+
+func TestNewTreeWithHash(t *testing.T) {
+	data := testData(5)
+	tree, err := NewTreeWithHash(&data, SHA256)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	expected, _ := NewTree(&data, HashFuncSHA256)
+	if !bytes.Equal(tree.RootHash(), expected.RootHash()) || tree.HashID != SHA256 {
+		t.Fatalf("Tree built with registered SHA256 doesn't match")
+	}
+	proof, _ := tree.GenerateMerkleProofByIndex(2)
+	if proof.HashID != SHA256 {
+		t.Fatalf("Proof records hash %v, expected sha256", proof.HashID)
+	}
+	encoded, _ := proof.MarshalBinary()
+	var decoded Proof
+	if err := decoded.UnmarshalBinary(encoded); err != nil || decoded.HashID != SHA256 {
+		t.Fatalf("Binary round trip lost hash id, got %v and error %v", decoded.HashID, err)
+	}
+	encoded, _ = json.Marshal(proof)
+	decoded = Proof{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded.HashID != SHA256 {
+		t.Fatalf("JSON round trip lost hash id, got %v and error %v", decoded.HashID, err)
+	}
+
+	//Version 1 encoding has no hash id
+	v1 := []byte{1, 1, 32, 1}
+	v1 = append(v1, proof.Hashes[0]...)
+	decoded = Proof{}
+	if err := decoded.UnmarshalBinary(v1); err != nil || decoded.HashID != HashUnknown || decoded.Indexes[0] != 1 {
+		t.Fatalf("Failed to decode version 1 proof, got %v and error %v", decoded, err)
+	}
+	if _, err := NewTreeWithHash(&data, HashUnknown); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported building a tree with an unregistered hash, got %v", err)
+	}
+}
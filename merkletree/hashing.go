@@ -0,0 +1,141 @@
+package merkletree
+
+import (
+	"bytes"
+	"hash"
+	"sync"
+)
+
+const (
+	//Prefixes used for domain separation as per RFC 6962 section 2.1
+	leafHashPrefix byte = 0x00
+	nodeHashPrefix byte = 0x01
+)
+
+var (
+	leafPrefix = []byte{leafHashPrefix}
+	nodePrefix = []byte{nodeHashPrefix}
+)
+
+/*
+Digests reused across hash computations of trees built using NewTreeWithHasher.
+Digests are never shared, so it is safe to use from multiple goroutines.
+*/
+type digestPool struct {
+	size int
+	pool sync.Pool
+}
+
+func newDigestPool(newHash func() hash.Hash) *digestPool {
+	p := digestPool{size: newHash().Size()}
+	p.pool.New = func() interface{} {
+		return newHash()
+	}
+	return &p
+}
+
+/*
+Appends hash of prefix||left||right to dst. No allocation takes place when dst has room for the hash.
+*/
+func (p *digestPool) sum(dst []byte, prefix []byte, left []byte, right []byte) []byte {
+	h := p.pool.Get().(hash.Hash)
+	h.Reset()
+	h.Write(prefix)
+	h.Write(left)
+	h.Write(right)
+	dst = h.Sum(dst)
+	p.pool.Put(h)
+	return dst
+}
+
+/*
+Returns the hash of data as a leaf of a tree built using hashFunc and opts, e.g. to list leaves in a manifest.
+Accepts
+  - data of the leaf
+  - Hash function the tree is built with
+  - Options the tree is built with, only WithDomainSeparation changes leaf hashes
+
+Returns
+  - hash of the leaf
+  - error from hash function
+*/
+func HashLeaf(data []byte, hashFunc HashFunction, opts ...Option) ([]byte, error) {
+	config := newTreeConfig(opts)
+	return config.hashLeaf(hashFunc, data)
+}
+
+func (c *treeConfig) hashLeaf(hashFunc HashFunction, data []byte) ([]byte, error) {
+	return c.hashLeafTo(nil, hashFunc, data)
+}
+
+/*
+Same as hashLeaf, writing the hash into dst when the tree reuses digests.
+*/
+func (c *treeConfig) hashLeafTo(dst []byte, hashFunc HashFunction, data []byte) ([]byte, error) {
+	if c.digests != nil {
+		var prefix []byte
+		if c.domainSeparation {
+			prefix = leafPrefix
+		}
+		return c.digests.sum(dst, prefix, data, nil), nil
+	}
+	if !c.domainSeparation {
+		return hashFunc(data)
+	}
+	buf := make([]byte, 0, 1+len(data))
+	buf = append(buf, leafHashPrefix)
+	buf = append(buf, data...)
+	return hashFunc(buf)
+}
+
+func (c *treeConfig) hashNode(hashFunc HashFunction, left []byte, right []byte) ([]byte, error) {
+	return c.hashNodeTo(nil, hashFunc, left, right)
+}
+
+/*
+Same as hashNode, writing the hash into dst when the tree reuses digests.
+*/
+func (c *treeConfig) hashNodeTo(dst []byte, hashFunc HashFunction, left []byte, right []byte) ([]byte, error) {
+	if c.sortedPairs && bytes.Compare(left, right) > 0 {
+		left, right = right, left
+	}
+	var prefix []byte
+	if c.domainSeparation {
+		prefix = nodePrefix
+	}
+	if c.digests != nil {
+		return c.digests.sum(dst, prefix, left, right), nil
+	}
+	//Always copy into a new buffer, appending to left could overwrite data sharing its backing array
+	buf := make([]byte, 0, len(prefix)+len(left)+len(right))
+	buf = append(buf, prefix...)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	return hashFunc(buf)
+}
+
+/*
+Hashes the concatenated hashes of all children of a node of a k-ary tree, prefixed with 0x01 under domain separation.
+Writes the hash into dst when the tree reuses digests.
+*/
+func (c *treeConfig) hashChildrenTo(dst []byte, hashFunc HashFunction, children []byte) ([]byte, error) {
+	var prefix []byte
+	if c.domainSeparation {
+		prefix = nodePrefix
+	}
+	if c.digests != nil {
+		return c.digests.sum(dst, prefix, children, nil), nil
+	}
+	buf := make([]byte, 0, len(prefix)+len(children))
+	buf = append(buf, prefix...)
+	buf = append(buf, children...)
+	return hashFunc(buf)
+}
+
+func (t *MerkleTree) hashLeaf(data []byte) ([]byte, error) {
+	return t.config.hashLeaf(t.HashFunc, data)
+}
+
+func (t *MerkleTree) hashNode(left []byte, right []byte) ([]byte, error) {
+	return t.config.hashNode(t.HashFunc, left, right)
+}
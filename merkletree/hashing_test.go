@@ -0,0 +1,262 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// Leaf inputs and expected roots from the Certificate Transparency reference implementation tests.
+var ctLeaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+var ctRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func ctData(t *testing.T, count int) Data {
+	var data Data
+	for _, leaf := range ctLeaves[:count] {
+		d, err := hex.DecodeString(leaf)
+		if err != nil {
+			t.Fatalf("Invalid test vector %q", leaf)
+		}
+		data = append(data, d)
+	}
+	return data
+}
+
+func ctRoot(t *testing.T, count int) []byte {
+	root, err := hex.DecodeString(ctRoots[count-1])
+	if err != nil {
+		t.Fatalf("Invalid test vector %q", ctRoots[count-1])
+	}
+	return root
+}
+
+func TestRFC6962CTVectors(t *testing.T) {
+	for count := 1; count <= len(ctLeaves); count++ {
+		data := ctData(t, count)
+		tree, err := NewTree(&data, HashFuncSHA256, WithRFC6962())
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		if !bytes.Equal(tree.RootHash(), ctRoot(t, count)) {
+			t.Fatalf("Root for %d leaves is %x, expected CT root %s", count, tree.RootHash(), ctRoots[count-1])
+		}
+		//Duplicate padding only matches RFC 6962 when the leaf count is a power of 2
+		padded, _ := NewTree(&data, HashFuncSHA256, WithDomainSeparation())
+		if powerOf2 := count > 1 && count&(count-1) == 0; bytes.Equal(padded.RootHash(), ctRoot(t, count)) != powerOf2 {
+			t.Fatalf("Root for %d leaves without odd node promotion is %x, expected it to match CT root only for powers of 2", count, padded.RootHash())
+		}
+		for i := range data {
+			proof, err := tree.GenerateMerkleProofByIndex(i)
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+			}
+			if verified, err := tree.VerifyProof(&data[i], proof); !verified {
+				t.Fatalf("Failed to verify Merkle Proof for leaf %d due to error %v", i, err)
+			}
+			path, err := tree.GetMerklePath(&data[i])
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Path due to error %v", err)
+			}
+			leafHash, _ := HashFuncSHA256(append([]byte{leafHashPrefix}, data[i]...))
+			if !bytes.Equal(path.Hashes[0], leafHash) {
+				t.Fatalf("Merkle Path for leaf %d doesn't start with the prefixed leaf hash", i)
+			}
+		}
+		if err := tree.UpdateLeafAt(count-1, []byte("updated")); err != nil {
+			t.Fatalf("Failed to update leaf due to error %v", err)
+		}
+		data[count-1] = []byte("updated")
+		expected, _ := NewTree(&data, HashFuncSHA256, WithRFC6962())
+		if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+			t.Fatalf("Root after update doesn't match rebuilt tree for %d leaves", count)
+		}
+	}
+}
+
+func TestDomainSeparationSecondPreimage(t *testing.T) {
+	data := testData(4)
+	for _, domainSeparation := range []bool{false, true} {
+		var opts []Option
+		if domainSeparation {
+			opts = append(opts, WithDomainSeparation())
+		}
+		tree, err := NewTree(&data, HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		//Present the first non-leaf node as a leaf, with its sibling as the proof.
+		left, right := tree.Root.Left, tree.Root.Right
+		forged := append(append([]byte{}, left.Left.Hash...), left.Right.Hash...)
+		proof := &Proof{Hashes: [][]byte{right.Hash}, Indexes: []int{1}}
+		verified, _ := tree.VerifyProof(&forged, proof)
+		if verified == domainSeparation {
+			t.Fatalf("Forged leaf verification returned %t with domain separation set to %t", verified, domainSeparation)
+		}
+	}
+}
+
+func TestOddNodePromotionCTVectors(t *testing.T) {
+	for count := 1; count <= len(ctLeaves); count++ {
+		data := ctData(t, count)
+		tree, err := NewTree(&data, HashFuncSHA256, WithDomainSeparation(), WithOddNodePromotion())
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		if !bytes.Equal(tree.RootHash(), ctRoot(t, count)) {
+			t.Fatalf("Root for %d leaves is %x, expected %s", count, tree.RootHash(), ctRoots[count-1])
+		}
+		if len(tree.Leaves) != count || tree.LeafCount() != count {
+			t.Fatalf("Expected %d leaves without padding, got %d", count, len(tree.Leaves))
+		}
+		for i := range data {
+			proof, err := tree.GenerateMerkleProofByIndex(i)
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+			}
+			if len(proof.Hashes) > tree.Depth {
+				t.Fatalf("Proof for leaf %d of %d is longer than depth %d", i, count, tree.Depth)
+			}
+			if verified, err := tree.VerifyProof(&data[i], proof); !verified {
+				t.Fatalf("Failed to verify Merkle Proof for leaf %d of %d due to error %v", i, count, err)
+			}
+			if _, err := tree.GetMerklePath(&data[i]); err != nil {
+				t.Fatalf("Failed to generate Merkle Path due to error %v", err)
+			}
+		}
+	}
+}
+
+func TestOddNodePromotionProofLength(t *testing.T) {
+	data := testData(5)
+	tree, err := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	//The fifth leaf is promoted twice and only pairs with the root of the first four.
+	proof, err := tree.GenerateMerkleProofByIndex(4)
+	if err != nil {
+		t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+	}
+	if len(proof.Hashes) != 1 || proof.Indexes[0] != 0 {
+		t.Fatalf("Expected a single left sibling for the promoted leaf, got %v", proof)
+	}
+	for _, i := range []int{0, 4} {
+		newValue := []byte("updated")
+		if err := tree.UpdateLeafAt(i, newValue); err != nil {
+			t.Fatalf("Failed to update leaf due to error %v", err)
+		}
+		data[i] = newValue
+		expected, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+		if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+			t.Fatalf("Root after updating leaf %d doesn't match rebuilt tree", i)
+		}
+	}
+}
+
+func TestOddNodePromotionDuplicateCollision(t *testing.T) {
+	odd := Data{[]byte("a"), []byte("b"), []byte("c")}
+	padded := Data{[]byte("a"), []byte("b"), []byte("c"), []byte("c")}
+
+	//Duplicating the last leaf makes both lists produce the same root
+	oddTree, _ := NewTree(&odd, HashFuncSHA256)
+	paddedTree, _ := NewTree(&padded, HashFuncSHA256)
+	if !bytes.Equal(oddTree.RootHash(), paddedTree.RootHash()) {
+		t.Fatalf("Expected duplicate padding collision without odd node promotion")
+	}
+
+	oddTree, _ = NewTree(&odd, HashFuncSHA256, WithOddNodePromotion())
+	paddedTree, _ = NewTree(&padded, HashFuncSHA256, WithOddNodePromotion())
+	if bytes.Equal(oddTree.RootHash(), paddedTree.RootHash()) {
+		t.Fatalf("Expected different roots for [a,b,c] and [a,b,c,c] with odd node promotion")
+	}
+	proof, err := paddedTree.GenerateMerkleProofByIndex(3)
+	if err != nil {
+		t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+	}
+	if verified, _ := oddTree.VerifyProof(&padded[3], proof); verified {
+		t.Fatalf("Proof for the padded leaf must not verify against [a,b,c]")
+	}
+	proof.Hashes = append(proof.Hashes, oddTree.RootHash())
+	proof.Indexes = append(proof.Indexes, 1)
+	if verified, err := oddTree.VerifyProof(&padded[3], proof); verified || err == nil {
+		t.Fatalf("Proof longer than the tree depth must be rejected")
+	}
+}
+
+func TestNewTreeWithHasher(t *testing.T) {
+	modes := [][]Option{nil, {WithDomainSeparation(), WithOddNodePromotion()}, {WithSortedLeaves(), WithSortedPairs()}, {WithWorkers(4)}}
+	for _, opts := range modes {
+		for _, count := range []int{1, 2, 7, 600} {
+			data := testData(count)
+			tree, err := NewTreeWithHasher(&data, sha256.New, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			expected, _ := NewTree(&data, HashFuncSHA256, opts...)
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+				t.Fatalf("Root of %d leaves doesn't match tree built with HashFunction", count)
+			}
+			if err := tree.AppendLeaf([]byte("Appended")); err != nil {
+				t.Fatalf("Failed to append leaf due to error %v", err)
+			}
+			expected.AppendLeaf([]byte("Appended"))
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+				t.Fatalf("Root after append to %d leaves doesn't match tree built with HashFunction", count)
+			}
+		}
+	}
+}
+
+func TestNewTreeWithHasherAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocation counts are not stable under the race detector")
+	}
+	data := testData(1024)
+	allocs := testing.AllocsPerRun(5, func() {
+		NewTreeWithHasher(&data, sha256.New)
+	})
+	//A few allocations per level, independent of the number of nodes
+	if allocs > 100 {
+		t.Fatalf("Building 1024 leaves took %v allocations", allocs)
+	}
+}
+
+func TestHashNodeDoesNotAlias(t *testing.T) {
+	//Hashes are handed out from one buffer, so appending to one would overwrite the next
+	arena := make([]byte, 0, 32*64)
+	arenaHash := func(data []byte) ([]byte, error) {
+		sum := sha256.Sum256(data)
+		start := len(arena)
+		arena = append(arena, sum[:]...)
+		return arena[start:len(arena):cap(arena)], nil
+	}
+	data := testData(8)
+	tree, err := NewTree(&data, arenaHash)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	expected, _ := NewTree(&data, HashFuncSHA256)
+	if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+		t.Fatalf("Root doesn't match, node hashing wrote into a hash sharing its backing array")
+	}
+}
@@ -0,0 +1,156 @@
+package merkletree
+
+import "fmt"
+
+/*
+Returns the number of children of a non-leaf node, 2 unless the tree is built using WithBranching.
+*/
+func (c *treeConfig) arity() int {
+	if c.branching < 3 {
+		return 2
+	}
+	return c.branching
+}
+
+/*
+Returns error if the branching factor is out of range or can't be combined with other options.
+*/
+func (c *treeConfig) checkBranching() error {
+	if c.branching > MaxBranching {
+		return fmt.Errorf("%w: branching factor %d exceeds max supported %d", ErrUnsupported, c.branching, MaxBranching)
+	}
+	if c.arity() == 2 {
+		return nil
+	}
+	if c.store != nil {
+		return fmt.Errorf("%w: trees with branching factor %d can't be kept in a node store", ErrUnsupported, c.branching)
+	}
+	if c.sortedPairs {
+		return fmt.Errorf("%w: sorted pairs require a binary tree, got branching factor %d", ErrUnsupported, c.branching)
+	}
+	return nil
+}
+
+/*
+Returns error naming operation if the tree isn't a binary one.
+*/
+func (t *MerkleTree) requireBinary(operation string) error {
+	return t.config.requireBinary(operation)
+}
+
+/*
+Returns error naming operation if options select a tree that isn't a binary one.
+*/
+func (c *treeConfig) requireBinary(operation string) error {
+	if k := c.arity(); k > 2 {
+		return fmt.Errorf("%w: %s require a binary tree, got branching factor %d", ErrUnsupported, operation, k)
+	}
+	return nil
+}
+
+/*
+Groups every k consecutive nodes of a k-ary tree and returns the parents created for them, in order.
+*/
+func buildGroupLevel(nodes []*Node, k int, tree *MerkleTree) ([]*Node, error) {
+	levelCount := (len(nodes) + k - 1) / k
+	levelNodes := make([]*Node, levelCount)
+	//Nodes, child lists and hashes are allocated once for the whole level
+	parents := make([]Node, levelCount)
+	children := make([]*Node, levelCount*k)
+	hashes := tree.hashSlab(levelCount)
+
+	buildRange := func(start, end int) error {
+		var joined []byte
+		for j := start; j < end; j += k {
+			group := nodes[j:end]
+			if len(group) > k {
+				group = group[:k]
+			}
+			if len(group) == 1 && tree.config.promoteOddNodes {
+				levelNodes[j/k] = group[0]
+				break
+			}
+			slot := children[j : j+k : j+k]
+			copy(slot, group)
+			if tree.config.promoteOddNodes {
+				slot = slot[:len(group)]
+			} else {
+				//Pad the last group of the level with copies of its last node
+				for i := len(group); i < k; i++ {
+					slot[i] = group[len(group)-1]
+				}
+			}
+			node := &parents[j/k]
+			var err error
+			if joined, err = initGroupNode(node, slot, joined, tree.hashSlot(hashes, j/k), tree); err != nil {
+				return err
+			}
+			levelNodes[j/k] = node
+		}
+		return nil
+	}
+	//Chunks are aligned to groups, so every goroutine builds parents of a disjoint set of subtrees.
+	if tree.config.parallel(len(nodes)) {
+		return levelNodes, parallelFor(len(nodes), tree.config.workers, k, buildRange)
+	}
+	return levelNodes, buildRange(0, len(nodes))
+}
+
+/*
+Sets node as parent of children, hashing into dst when the tree reuses digests.
+Child hashes are concatenated into buf, which is returned for reuse.
+*/
+func initGroupNode(node *Node, children []*Node, buf []byte, dst []byte, tree *MerkleTree) ([]byte, error) {
+	node.Children = children
+	node.Left = children[0]
+	node.Right = children[len(children)-1]
+	buf = buf[:0]
+	for _, child := range children {
+		buf = append(buf, child.Hash...)
+		child.Parent = node
+	}
+	var err error
+	node.Hash, err = tree.config.hashChildrenTo(dst, tree.HashFunc, buf)
+	return buf, err
+}
+
+/*
+Appends to proof the path from node up to the root of a k-ary tree, each entry holding the concatenated hashes of its siblings.
+*/
+func (t *MerkleTree) appendGroupPath(proof *Proof, node *Node) {
+	proof.Branching = t.config.arity()
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		position := parent.childPosition(node)
+		siblings := make([]byte, 0, (len(parent.Children)-1)*len(node.Hash))
+		for i, child := range parent.Children {
+			if i != position {
+				siblings = append(siblings, child.Hash...)
+			}
+		}
+		proof.Hashes = append(proof.Hashes, siblings)
+		proof.Indexes = append(proof.Indexes, position)
+		node = parent
+	}
+}
+
+/*
+Hashes cur with the concatenated hashes of its siblings from a proof of a k-ary tree, index being the position of cur among them.
+*/
+func (c *treeConfig) hashGroupStep(hashFunc HashFunction, cur []byte, siblings []byte, index int) ([]byte, error) {
+	size := len(cur)
+	if size == 0 || len(siblings) == 0 || len(siblings)%size != 0 {
+		return nil, malformedProof("sibling hashes of %d bytes are not a multiple of hash size %d", len(siblings), size)
+	}
+	count := len(siblings) / size
+	if count >= c.arity() {
+		return nil, malformedProof("%d sibling hashes exceed branching factor %d", count, c.arity())
+	}
+	if index > count {
+		return nil, malformedProof("index %d is past %d sibling hashes", index, count)
+	}
+	joined := make([]byte, 0, len(siblings)+size)
+	joined = append(joined, siblings[:index*size]...)
+	joined = append(joined, cur...)
+	joined = append(joined, siblings[index*size:]...)
+	return c.hashChildrenTo(nil, hashFunc, joined)
+}
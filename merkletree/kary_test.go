@@ -0,0 +1,316 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func hashConcat(t *testing.T, hashes ...[]byte) []byte {
+	t.Helper()
+	hash, err := HashFuncSHA256(bytes.Join(hashes, nil))
+	if err != nil {
+		t.Fatalf("Failed to hash due to error %v", err)
+	}
+	return hash
+}
+
+func TestKaryRoot(t *testing.T) {
+	data := testData(6)
+	h := make([][]byte, len(data))
+	for i := range data {
+		h[i], _ = HashFuncSHA256(data[i])
+	}
+
+	tree, err := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	first, last := hashConcat(t, h[0], h[1], h[2], h[3]), hashConcat(t, h[4], h[5], h[5], h[5])
+	if expected := hashConcat(t, first, last, last, last); !bytes.Equal(tree.RootHash(), expected) || tree.Depth != 2 {
+		t.Fatalf("Padded 4-ary root doesn't match, depth %d", tree.Depth)
+	}
+	if len(tree.Leaves) != 6 || tree.LeafCount() != 6 {
+		t.Fatalf("Expected 6 leaves without padding, got %d", len(tree.Leaves))
+	}
+
+	tree, _ = NewTree(&data, HashFuncSHA256, WithBranching(4), WithOddNodePromotion())
+	last = hashConcat(t, h[4], h[5])
+	if expected := hashConcat(t, first, last); !bytes.Equal(tree.RootHash(), expected) {
+		t.Fatalf("4-ary root with promotion doesn't match")
+	}
+
+	data = data[:5]
+	tree, _ = NewTree(&data, HashFuncSHA256, WithBranching(4), WithOddNodePromotion())
+	if expected := hashConcat(t, first, h[4]); !bytes.Equal(tree.RootHash(), expected) {
+		t.Fatalf("4-ary root with promoted leaf doesn't match")
+	}
+}
+
+func TestKaryDepth(t *testing.T) {
+	for _, tc := range []struct {
+		branching, count, depth int
+	}{
+		{3, 1, 0}, {3, 3, 1}, {3, 4, 2}, {3, 9, 2}, {3, 10, 3},
+		{4, 16, 2}, {4, 17, 3}, {16, 16, 1}, {16, 17, 2}, {16, 256, 2}, {16, 257, 3},
+	} {
+		data := testData(tc.count)
+		for _, opts := range [][]Option{{WithBranching(tc.branching)}, {WithBranching(tc.branching), WithOddNodePromotion()}} {
+			tree, err := NewTree(&data, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			if tree.Depth != tc.depth || len(tree.levels) != tc.depth+1 {
+				t.Fatalf("%d-ary tree with %d leaves has depth %d and %d levels, expected depth %d",
+					tc.branching, tc.count, tree.Depth, len(tree.levels), tc.depth)
+			}
+		}
+	}
+}
+
+func TestKaryProofs(t *testing.T) {
+	for _, branching := range []int{3, 4, 16} {
+		for _, count := range []int{1, 2, 5, 16, 17, 40} {
+			data := testData(count)
+			for _, opts := range [][]Option{
+				{WithBranching(branching)},
+				{WithBranching(branching), WithOddNodePromotion(), WithDomainSeparation()},
+			} {
+				tree, err := NewTree(&data, HashFuncSHA256, opts...)
+				if err != nil {
+					t.Fatalf("Failed to build Tree due to error %v", err)
+				}
+				for i := range data {
+					proof, err := tree.GenerateMerkleProof(&data[i])
+					if err != nil {
+						t.Fatalf("Failed to generate proof for leaf %d due to error %v", i, err)
+					}
+					if len(proof.Hashes) > tree.Depth {
+						t.Fatalf("Proof for leaf %d has %d levels, tree depth is %d", i, len(proof.Hashes), tree.Depth)
+					}
+					for level, siblings := range proof.Hashes {
+						if len(siblings) == 0 || len(siblings) > (branching-1)*sha256.Size {
+							t.Fatalf("Proof for leaf %d holds %d bytes of siblings at level %d", i, len(siblings), level)
+						}
+					}
+					if verified, err := tree.VerifyProof(&data[i], proof); !verified {
+						t.Fatalf("Failed to verify proof for leaf %d of %d in %d-ary tree due to error %v", i, count, branching, err)
+					}
+					if verified, err := VerifyProof(tree.RootHash(), data[i], proof, HashFuncSHA256, opts...); !verified {
+						t.Fatalf("Failed to verify proof for leaf %d without the tree due to error %v", i, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestKaryProofTampered(t *testing.T) {
+	data := testData(20)
+	tree, _ := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	proof, _ := tree.GenerateMerkleProofByIndex(6)
+	if proof.Indexes[0] != 2 || len(proof.Hashes[0]) != 3*sha256.Size {
+		t.Fatalf("Expected position 2 and 3 siblings at the leaf level, got %d and %d bytes", proof.Indexes[0], len(proof.Hashes[0]))
+	}
+
+	moved := &Proof{Hashes: proof.Hashes, Indexes: append([]int{3}, proof.Indexes[1:]...)}
+	if verified, err := tree.VerifyProof(&data[6], moved); verified || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected root mismatch for wrong position, got %t, %v", verified, err)
+	}
+	truncated := &Proof{Hashes: append([][]byte{proof.Hashes[0][1:]}, proof.Hashes[1:]...), Indexes: proof.Indexes}
+	if verified, err := tree.VerifyProof(&data[6], truncated); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for truncated siblings, got %t, %v", verified, err)
+	}
+	past := &Proof{Hashes: proof.Hashes, Indexes: append([]int{4}, proof.Indexes[1:]...)}
+	if verified, err := VerifyProof(tree.RootHash(), data[6], past, HashFuncSHA256, WithBranching(4)); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for index past branching factor, got %t, %v", verified, err)
+	}
+	if verified, err := VerifyProof(tree.RootHash(), data[6], proof, HashFuncSHA256); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected binary verification of 4-ary proof to fail, got %t, %v", verified, err)
+	}
+}
+
+func TestKaryProofJSON(t *testing.T) {
+	data := testData(40)
+	tree, _ := NewTree(&data, HashFuncSHA256, WithBranching(16))
+	proof, _ := tree.GenerateMerkleProofByIndex(37)
+	encoded, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Failed to encode proof due to error %v", err)
+	}
+	var decoded Proof
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode proof due to error %v", err)
+	}
+	if verified, err := tree.VerifyProof(&data[37], &decoded); !verified {
+		t.Fatalf("Failed to verify decoded proof due to error %v", err)
+	}
+	if decoded.Branching != 16 {
+		t.Fatalf("Expected decoded proof to keep branching factor 16, got %d", decoded.Branching)
+	}
+}
+
+func TestKaryProofBinary(t *testing.T) {
+	for _, test := range []struct {
+		count     int
+		branching int
+		opts      []Option
+	}{
+		{40, 16, nil},
+		{64, 4, nil},
+		{27, 3, []Option{WithOddNodePromotion()}},
+		{300, MaxBranching, []Option{WithDomainSeparation()}},
+	} {
+		data := testData(test.count)
+		opts := append([]Option{WithBranching(test.branching)}, test.opts...)
+		tree, _ := NewTree(&data, HashFuncSHA256, opts...)
+		for _, index := range []int{0, test.count / 2, test.count - 1} {
+			proof, _ := tree.GenerateMerkleProofByIndex(index)
+			encoded, err := proof.MarshalBinary()
+			if err != nil {
+				t.Fatalf("Failed to encode proof of leaf %d of %d-ary tree due to error %v", index, test.branching, err)
+			}
+			if encoded[0] != KaryProofEncodingVersion {
+				t.Fatalf("Expected proof of %d-ary tree to be encoded using version %d, got %d", test.branching, KaryProofEncodingVersion, encoded[0])
+			}
+			if bound := EncodedKaryProofSize(len(proof.Hashes), 32, test.branching); len(encoded) > bound {
+				t.Fatalf("Encoded size %d exceeds estimate %d", len(encoded), bound)
+			}
+			var decoded Proof
+			if err := decoded.UnmarshalBinary(encoded); err != nil {
+				t.Fatalf("Failed to decode proof due to error %v", err)
+			}
+			if !reflect.DeepEqual(&decoded, proof) {
+				t.Fatalf("Decoded proof of leaf %d of %d-ary tree doesn't match the encoded one", index, test.branching)
+			}
+			if verified, err := VerifyProof(tree.RootHash(), data[index], &decoded, HashFuncSHA256, opts...); !verified {
+				t.Fatalf("Failed to verify decoded proof due to error %v", err)
+			}
+		}
+	}
+
+	//Every level of a full tree holds branching-1 siblings
+	data := testData(64)
+	tree, _ := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	proof, _ := tree.GenerateMerkleProofByIndex(9)
+	encoded, _ := proof.MarshalBinary()
+	if len(encoded) != EncodedKaryProofSize(len(proof.Hashes), 32, 4) {
+		t.Fatalf("Encoded size %d doesn't match estimate %d", len(encoded), EncodedKaryProofSize(len(proof.Hashes), 32, 4))
+	}
+	var decoded Proof
+	for _, n := range []int{1, 2, 3, 4, 5, len(encoded) - 1} {
+		if err := decoded.UnmarshalBinary(encoded[:n]); !errors.Is(err, ErrMalformedProof) {
+			t.Fatalf("Expected ErrMalformedProof decoding proof truncated to %d bytes, got %v", n, err)
+		}
+	}
+	if err := decoded.UnmarshalBinary(append(encoded, 0)); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof decoding proof with trailing bytes, got %v", err)
+	}
+	badPosition := append([]byte(nil), encoded...)
+	badPosition[4] = 4
+	if err := decoded.UnmarshalBinary(badPosition); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof decoding position past branching factor, got %v", err)
+	}
+	if verified, err := VerifyProof(tree.RootHash(), data[9], proof, HashFuncSHA256, WithBranching(8)); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof verifying proof of 4-ary tree as 8-ary one, got %v", err)
+	}
+}
+
+func TestKaryBuildVariants(t *testing.T) {
+	data := testData(1000)
+	opts := []Option{WithBranching(4), WithDomainSeparation()}
+	expected, _ := NewTree(&data, HashFuncSHA256, opts...)
+
+	parallel, err := NewTree(&data, HashFuncSHA256, append(opts, WithWorkers(3))...)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	hasher, err := NewTreeWithHasher(&data, sha256.New, opts...)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	for _, tree := range []*MerkleTree{parallel, hasher} {
+		if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+			t.Fatalf("Root doesn't match sequentially built 4-ary tree")
+		}
+	}
+}
+
+func TestKaryUpdate(t *testing.T) {
+	for _, promote := range []bool{false, true} {
+		opts := []Option{WithBranching(3)}
+		if promote {
+			opts = append(opts, WithOddNodePromotion())
+		}
+		data := testData(11)
+		tree, _ := NewTree(&data, HashFuncSHA256, opts...)
+		for _, i := range []int{0, 5, 10} {
+			data[i] = []byte("updated")
+			if err := tree.UpdateLeafAt(i, data[i]); err != nil {
+				t.Fatalf("Failed to update leaf %d due to error %v", i, err)
+			}
+			assertMatchesRebuilt(t, tree, data, opts...)
+		}
+		for i := 0; i < 12; i++ {
+			data = append(data, []byte{byte(i)})
+			if err := tree.AppendLeaf(data[len(data)-1]); err != nil {
+				t.Fatalf("Failed to append leaf due to error %v", err)
+			}
+			assertMatchesRebuilt(t, tree, data, opts...)
+		}
+		for _, i := range []int{22, 0, 9, 9} {
+			data = append(data[:i:i], data[i+1:]...)
+			if err := tree.RemoveLeafAt(i); err != nil {
+				t.Fatalf("Failed to remove leaf %d due to error %v", i, err)
+			}
+			assertMatchesRebuilt(t, tree, data, opts...)
+		}
+	}
+}
+
+func TestKaryDiff(t *testing.T) {
+	data := testData(50)
+	a, _ := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	b, _ := NewTree(&data, HashFuncSHA256, WithBranching(4))
+	for _, i := range []int{3, 17, 49} {
+		if err := b.UpdateLeafAt(i, []byte("changed")); err != nil {
+			t.Fatalf("Failed to update leaf %d due to error %v", i, err)
+		}
+	}
+	if diff := Diff(a, b); len(diff) != 3 || diff[0] != 3 || diff[1] != 17 || diff[2] != 49 {
+		t.Fatalf("Expected leaves 3, 17 and 49 to differ, got %v", diff)
+	}
+}
+
+func TestKaryUnsupported(t *testing.T) {
+	data := testData(8)
+	if _, err := NewTree(&data, HashFuncSHA256, WithBranching(MaxBranching+1)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for branching factor above MaxBranching, got %v", err)
+	}
+	if _, err := NewTree(&data, HashFuncSHA256, WithBranching(4), WithSortedPairs()); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported combining branching factor with sorted pairs, got %v", err)
+	}
+	if _, err := NewTree(&data, HashFuncSHA256, WithBranching(4), WithNodeStore(NewMemoryNodeStore())); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported combining branching factor with a node store, got %v", err)
+	}
+	tree, _ := NewTree(&data, HashFuncSHA256, WithBranching(4), WithOddNodePromotion())
+	if _, err := tree.GenerateMultiProof([]int{1, 2}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for multiproofs of a 4-ary tree, got %v", err)
+	}
+	if _, err := tree.GenerateConsistencyProof(3, 8); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for consistency proofs of a 4-ary tree, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for snapshots of a 4-ary tree, got %v", err)
+	}
+
+	binary, _ := NewTree(&data, HashFuncSHA256, WithBranching(2))
+	plain, _ := NewTree(&data, HashFuncSHA256)
+	if !bytes.Equal(binary.RootHash(), plain.RootHash()) || binary.Depth != plain.Depth {
+		t.Fatalf("Branching factor 2 should build the default binary tree")
+	}
+}
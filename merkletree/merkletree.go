@@ -2,8 +2,11 @@ package merkletree
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"math"
+	"hash"
+	"math/bits"
+	"sort"
 	// "github.com/m1gwings/treedrawer/tree"
 )
 
@@ -20,7 +23,20 @@ type MerkleTree struct {
 	Root     *Node
 	Leaves   []*Node
 	HashFunc HashFunction
-	Depth    int
+	//Registered hash function the tree is built with, HashUnknown for a HashFunction passed to NewTree.
+	HashID HashID
+	Depth  int
+	config treeConfig
+	//Built on the first lookup by hash, nil until then. Duplicate padding leaf is not indexed.
+	leafIndex hashIndex
+	//Nodes of each level starting from the leaves, last level holds only the root.
+	levels [][]*Node
+	//Stored root of a tree loaded using WithLazyLevels whose levels are not built yet.
+	lazyRoot []byte
+	//Number of leading leaves whose data is dropped by Prune.
+	pruned int
+	//Nodes dropped by Prune since surviving nodes were last moved out of the allocations shared with them.
+	dropped int
 }
 
 type Data [][]byte
@@ -36,7 +52,7 @@ func VerifyHashFuncMinSecurity(hashFunc HashFunction) error {
 		return err
 	}
 	if len(testHash) < 16 {
-		return fmt.Errorf("hash function is not secure enough, require a min 128 bit output to be generated")
+		return ErrInsecureHash
 	}
 	return nil
 }
@@ -47,30 +63,113 @@ Note that hash output of the hashFunction should be a min of 128 bits, otherwise
 Accepts
   - data list to be used for building the tree
   - Hash function to be used for hashing
+  - Optional settings changing how the tree is built, e.g. WithDomainSeparation
 
 Returns
   - Reference to the tree in case of no errors
   - error detailing cause of errror while building the tree
 */
-func NewTree(data *Data, hashFunc HashFunction) (*MerkleTree, error) {
+func NewTree(data *Data, hashFunc HashFunction, opts ...Option) (*MerkleTree, error) {
+	return newTree(data, hashFunc, newTreeConfig(opts))
+}
+
+/*
+Builds a new merkle tree like NewTree, hashing with digests created by newHash, e.g. sha256.New.
+Digests and buffers are reused, so building allocates a handful of times per level instead of a few times per node.
+HashFunc of the tree is set to a HashFunction computing the same hash.
+Accepts
+  - data list to be used for building the tree
+  - constructor of the digest to be used for hashing
+  - Optional settings changing how the tree is built
+
+Returns
+  - Reference to the tree in case of no errors
+  - error detailing cause of errror while building the tree
+*/
+func NewTreeWithHasher(data *Data, newHash func() hash.Hash, opts ...Option) (*MerkleTree, error) {
+	config := newTreeConfig(opts)
+	config.digests = newDigestPool(newHash)
+	digests := config.digests
+	hashFunc := func(data []byte) ([]byte, error) {
+		return digests.sum(nil, nil, data, nil), nil
+	}
+	return newTree(data, hashFunc, config)
+}
+
+/*
+Builds a new merkle tree from leaf hashes computed earlier, e.g. ones listed in a manifest, without the data behind them.
+Leaves hold no data. Proofs and lookups by data work the same as for a tree built using NewTree from that data.
+Accepts
+  - leaf hashes as computed by HashLeaf using the same hash function and options
+  - Hash function to be used for hashing
+  - Optional settings changing how the tree is built, WithNodeStore is not supported
+
+Returns
+  - Reference to the tree in case of no errors
+  - error detailing cause of errror while building the tree
+*/
+func NewTreeFromLeafHashes(hashes [][]byte, hashFunc HashFunction, opts ...Option) (*MerkleTree, error) {
 	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
 		return nil, err
 	}
+	config := newTreeConfig(opts)
+	if err := config.checkBranching(); err != nil {
+		return nil, err
+	}
+	if config.store != nil {
+		return nil, fmt.Errorf("%w: trees built from leaf hashes can't be kept in a node store", ErrUnsupported)
+	}
+	if len(hashes) == 0 {
+		return nil, ErrEmptyData
+	}
+	tree := MerkleTree{HashFunc: hashFunc, config: config}
+	nodes := make([]Node, len(hashes))
+	tree.Leaves = make([]*Node, len(hashes), len(hashes)+1)
+	for i, hash := range hashes {
+		nodes[i] = Node{Hash: hash, IsLeaf: true}
+		tree.Leaves[i] = &nodes[i]
+	}
+	if err := tree.arrangeLeaves(); err != nil {
+		return nil, err
+	}
+	tree.Depth = config.depth(len(hashes))
+	tree.levels = [][]*Node{tree.Leaves}
+	var err error
+	tree.Root, err = buildIntermediateLevel(tree.Leaves, &tree)
+	if err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+func newTree(data *Data, hashFunc HashFunction, config treeConfig) (*MerkleTree, error) {
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	if err := config.checkBranching(); err != nil {
+		return nil, err
+	}
 	var tree MerkleTree
 	tree.HashFunc = hashFunc
+	tree.config = config
 
 	leafCount := len(*data)
 	//fmt.Println("Number of leaves:", leafCount)
 	if leafCount == 0 {
-		return nil, fmt.Errorf("error: cannot build a merkle tree without any data")
+		return nil, ErrEmptyData
+	}
+	if tree.config.store != nil {
+		if err := tree.buildInStore(data); err != nil {
+			return nil, err
+		}
+		return &tree, nil
 	}
 	err := populateLeaves(data, &tree)
 	if err != nil {
 		return nil, err
 	}
-	leafCount = len(tree.Leaves)
-	//Calculate Tree depth based on number of leaves considering it is a binary hash tree
-	tree.Depth = int(math.Log2(float64(leafCount)))
+	tree.Depth = tree.config.depth(leafCount)
+	tree.levels = [][]*Node{tree.Leaves}
 	tree.Root, err = buildIntermediateLevel(tree.Leaves, &tree)
 	if err != nil {
 		return nil, err
@@ -78,39 +177,96 @@ func NewTree(data *Data, hashFunc HashFunction) (*MerkleTree, error) {
 	return &tree, nil
 }
 
+/*
+Returns depth of a tree with leafCount leaves.
+Each level divides the node count by the branching factor rounding up, hence depth is ceil(log_k(leafCount)) after padding.
+*/
+func (c *treeConfig) depth(leafCount int) int {
+	if k := c.arity(); k > 2 {
+		depth := 0
+		for size := leafCount; size > 1; size = (size + k - 1) / k {
+			depth++
+		}
+		return depth
+	}
+	if c.needsPadLeaf(leafCount) {
+		leafCount++
+	}
+	return bits.Len(uint(leafCount - 1))
+}
+
+/*
+Reports whether a duplicate leaf pads leafCount leaves, which binary trees do for an odd count unless odd nodes are promoted.
+Levels of k-ary trees are padded while building their parents instead.
+*/
+func (c *treeConfig) needsPadLeaf(leafCount int) bool {
+	return leafCount%2 == 1 && !c.promoteOddNodes && c.arity() == 2
+}
+
 func populateLeaves(data *Data, tree *MerkleTree) error {
 	leafCount := len(*data)
 
-	//TODO : sort leaves and then build tree so that same root hash is generated even if data order is different.
 	//Create Leaf nodes
-	for _, val := range *data {
-		node, err := buildLeafNode(val, nil, tree.HashFunc)
-		if err != nil {
-			return err
+	tree.Leaves = make([]*Node, leafCount, leafCount+1)
+	//Nodes and hashes are allocated once for the whole level
+	nodes := make([]Node, leafCount)
+	hashes := tree.hashSlab(leafCount)
+	buildLeaves := func(start, end int) error {
+		var err error
+		for i := start; i < end; i++ {
+			node := &nodes[i]
+			node.Data = (*data)[i]
+			node.IsLeaf = true
+			node.Hash, err = tree.config.hashLeafTo(tree.hashSlot(hashes, i), tree.HashFunc, node.Data)
+			if err != nil {
+				return err
+			}
+			tree.Leaves[i] = node
 		}
+		return nil
+	}
+	var err error
+	if tree.config.parallel(leafCount) {
+		err = parallelFor(leafCount, tree.config.workers, 1, buildLeaves)
+	} else {
+		err = buildLeaves(0, leafCount)
+	}
+	if err != nil {
+		return err
+	}
+	return tree.arrangeLeaves()
+}
 
-		tree.Leaves = append(tree.Leaves, node)
+/*
+Sorts leaves when the tree is built using WithSortedLeaves and adds the duplicate leaf padding an odd count.
+*/
+func (t *MerkleTree) arrangeLeaves() error {
+	leafCount := len(t.Leaves)
+	if t.config.sortedLeaves {
+		sort.Slice(t.Leaves, func(i, j int) bool {
+			return bytes.Compare(t.Leaves[i].Hash, t.Leaves[j].Hash) < 0
+		})
 	}
 
-	if leafCount%2 == 1 {
+	if t.config.needsPadLeaf(leafCount) {
 		// Handle case of odd leaves. Create a duplicate leaf node
-		node, err := buildLeafNode(tree.Leaves[leafCount-1].Data, tree.Leaves[leafCount-1].Hash, tree.HashFunc)
-		node.IsDuplicate = true
+		node, err := buildLeafNode(t.Leaves[leafCount-1].Data, t.Leaves[leafCount-1].Hash, t)
 		if err != nil {
 			return err
 		}
-		tree.Leaves = append(tree.Leaves, node)
+		node.IsDuplicate = true
+		t.Leaves = append(t.Leaves, node)
 	}
 
 	return nil
 }
 
-func buildLeafNode(data []byte, hash []byte, hashFunction HashFunction) (*Node, error) {
+func buildLeafNode(data []byte, hash []byte, tree *MerkleTree) (*Node, error) {
 	var node Node
 	var err error
 	node.Data = data
 	if hash == nil {
-		node.Hash, err = hashFunction(node.Data)
+		node.Hash, err = tree.hashLeaf(node.Data)
 	} else {
 		node.Hash = hash
 	}
@@ -122,102 +278,273 @@ func buildLeafNode(data []byte, hash []byte, hashFunction HashFunction) (*Node,
 }
 
 func buildIntermediateLevel(nodes []*Node, tree *MerkleTree) (*Node, error) {
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	levelNodes, err := buildParentLevel(nodes, tree)
+	if err != nil {
+		return nil, err
+	}
+	tree.levels = append(tree.levels, levelNodes)
+	return buildIntermediateLevel(levelNodes, tree)
+}
+
+/*
+Pairs consecutive nodes and returns the parents created for them, in order.
+*/
+func buildParentLevel(nodes []*Node, tree *MerkleTree) ([]*Node, error) {
+	if k := tree.config.arity(); k > 2 {
+		return buildGroupLevel(nodes, k, tree)
+	}
 	//var levelNodes []*Node
 	levelCount := len(nodes) / 2
 	if len(nodes)%2 == 1 {
 		levelCount = len(nodes)/2 + 1
 	}
 	levelNodes := make([]*Node, levelCount)
-	levelIndex := 0
-
-	//TODO:This recursion be optimized to run in parallel if there are too many leaves? Maybe breakdown chunks of subtrees build them.
-	for j := 0; j < len(nodes); j = j + 2 {
-		left := j
-		right := j + 1
-		//Possible vulnerability as explained here https://github.com/bitcoin/bitcoin/blob/master/src/consensus/merkle.cpp
-		//This should not effect a tree where each data element is expected to be unique.
-		//TODO: Can be optimized to take odd leaf to next level and not duplicate hash.
-		if right == len(nodes) {
-			right = j
-		}
-		node, err := createNonLeafNode(nodes[left], nodes[right], tree.HashFunc)
-		if err != nil {
-			return nil, err
-		}
-		levelNodes[levelIndex] = node
-		levelIndex++
-		//levelNodes = append(levelNodes, node)
-		if len(nodes) == 2 {
-			return node, nil
+	//Nodes and hashes are allocated once for the whole level
+	parents := make([]Node, levelCount)
+	hashes := tree.hashSlab(levelCount)
+
+	buildRange := func(start, end int) error {
+		for j := start; j < end; j = j + 2 {
+			left := j
+			right := j + 1
+			//Possible vulnerability as explained here https://github.com/bitcoin/bitcoin/blob/master/src/consensus/merkle.cpp
+			//This should not effect a tree where each data element is expected to be unique.
+			//WithOddNodePromotion avoids it by taking the odd node to next level and not duplicating hash.
+			if right == len(nodes) {
+				if tree.config.promoteOddNodes {
+					levelNodes[j/2] = nodes[left]
+					break
+				}
+				right = j
+			}
+			node := &parents[j/2]
+			if err := initNonLeafNode(node, nodes[left], nodes[right], tree.hashSlot(hashes, j/2), tree); err != nil {
+				return err
+			}
+			levelNodes[j/2] = node
 		}
+		return nil
 	}
-	return buildIntermediateLevel(levelNodes, tree)
+	//Chunks are aligned to pairs, so every goroutine builds parents of a disjoint set of subtrees.
+	if tree.config.parallel(len(nodes)) {
+		return levelNodes, parallelFor(len(nodes), tree.config.workers, 2, buildRange)
+	}
+	return levelNodes, buildRange(0, len(nodes))
 }
 
-func createNonLeafNode(left *Node, right *Node, hashFunction HashFunction) (*Node, error) {
+func createNonLeafNode(left *Node, right *Node, tree *MerkleTree) (*Node, error) {
 	var node Node
+	if err := initNonLeafNode(&node, left, right, nil, tree); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+/*
+Sets node as parent of left and right, hashing into dst when the tree reuses digests.
+*/
+func initNonLeafNode(node *Node, left *Node, right *Node, dst []byte, tree *MerkleTree) error {
 	var err error
 	node.Left = left
 	node.Right = right
-	node.Hash, err = hashFunction(append(left.Hash, right.Hash...))
+	node.Hash, err = tree.config.hashNodeTo(dst, tree.HashFunc, left.Hash, right.Hash)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	left.Parent = &node
-	right.Parent = &node
-	return &node, nil
+	left.Parent = node
+	right.Parent = node
+	return nil
+}
+
+/*
+Returns a buffer holding count hashes when the tree reuses digests, nil otherwise as HashFunction allocates its output.
+*/
+func (t *MerkleTree) hashSlab(count int) []byte {
+	if t.config.digests == nil {
+		return nil
+	}
+	return make([]byte, count*t.config.digests.size)
+}
+
+/*
+Returns the empty slice of slab where hash i is to be appended, capped so that it can't grow into hash i+1.
+*/
+func (t *MerkleTree) hashSlot(slab []byte, i int) []byte {
+	if slab == nil {
+		return nil
+	}
+	size := t.config.digests.size
+	return slab[i*size : i*size : (i+1)*size]
 }
 
 func (t *MerkleTree) RootHash() []byte {
 	return t.Root.Hash
 }
 
+/*
+Updates the leaf holding oldValue with newValue and recomputes hashes along its path to the root.
+If oldValue is present more than once, the first matching leaf is updated.
+Accepts
+  - value currently stored in the leaf
+  - new value for the leaf
+
+Returns
+  - error in case any error occurs or oldValue not found
+*/
 func (t *MerkleTree) UpdateLeaf(oldValue *[]byte, newValue *[]byte) error {
-	oldHash, err := t.HashFunc(*oldValue)
+	oldHash, err := t.hashLeaf(*oldValue)
 	if err != nil {
 		return err
 	}
-	leafIndex := -1
-	for i, node := range t.Leaves {
-		if bytes.Equal(node.Hash, oldHash) {
-			leafIndex = i
-			break
-		}
+	leafIndex, found := t.lookupLeaf(oldHash)
+	if !found {
+		return ErrLeafNotFound
+	}
+	return t.UpdateLeafAt(leafIndex, *newValue)
+}
+
+/*
+Updates the leaf at position index with newValue and recomputes hashes along its path to the root.
+In a tree built using WithSortedLeaves the leaf is moved to the sorted position of newValue.
+Accepts
+  - position of the leaf, starting at 0
+  - new value for the leaf
+
+Returns
+  - error in case any error occurs or index is out of range
+*/
+func (t *MerkleTree) UpdateLeafAt(index int, newValue []byte) error {
+	if index < 0 || index >= t.LeafCount() {
+		return fmt.Errorf("%w: leaf index %d not in [0, %d)", ErrIndexOutOfRange, index, t.LeafCount())
 	}
-	if leafIndex == -1 {
-		return fmt.Errorf("could not find leaf node to update")
+	if index < t.pruned {
+		return fmt.Errorf("%w: cannot update leaf %d", ErrPruned, index)
 	}
-	parent := t.Leaves[leafIndex].Parent
-	newHash, err := t.HashFunc(*newValue)
+	newHash, err := t.hashLeaf(newValue)
 	if err != nil {
 		return err
 	}
-	t.Leaves[leafIndex].Hash = newHash
-	t.Leaves[leafIndex].Data = *newValue
-	lastLeafIndex := len(t.Leaves)
-	if leafIndex == lastLeafIndex-1 && t.Leaves[lastLeafIndex].IsDuplicate {
+	if t.config.sortedLeaves && t.LeafCount() > 1 {
+		//Leaf moves to the sorted position of its new hash
+		return t.moveSortedLeaf(index, newValue, newHash)
+	}
+	if t.config.store != nil {
+		return t.storeUpdateLeaf(index, newHash)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return err
+	}
+	leaf := t.Leaves[index]
+	t.leafIndex.remove(leaf.Hash, index)
+	leaf.Hash = newHash
+	leaf.Data = newValue
+	t.leafIndex.add(newHash, index)
+	lastLeafIndex := len(t.Leaves) - 1
+	if index == lastLeafIndex-1 && t.Leaves[lastLeafIndex].IsDuplicate {
 		//Update if duplicate node is present.
 		t.Leaves[lastLeafIndex].Hash = newHash
-		t.Leaves[lastLeafIndex].Data = *newValue
-		t.Leaves[lastLeafIndex].IsDuplicate = false
+		t.Leaves[lastLeafIndex].Data = newValue
 	}
-	for parent != nil {
-		if bytes.Equal(parent.Left.Hash, newHash) { //Left Node
-			parent.Hash, err = t.HashFunc(append(newHash, parent.Right.Hash...))
-		} else { //Right Node
-			parent.Hash, err = t.HashFunc(append(parent.Left.Hash, newHash...))
+	return t.rehashPath(leaf.Parent)
+}
+
+/*
+Recomputes hashes of node and all its ancestors up to the root.
+*/
+func (t *MerkleTree) rehashPath(node *Node) error {
+	var err error
+	var buf []byte
+	for ; node != nil; node = node.Parent {
+		if node.Children != nil {
+			buf, err = initGroupNode(node, node.Children, buf, nil, t)
+		} else {
+			node.Hash, err = t.hashNode(node.Left.Hash, node.Right.Hash)
 		}
 		if err != nil {
 			return err
 		}
-		if parent.Parent == nil {
-			break
+	}
+	return nil
+}
+
+/*
+Returns the number of leaves in the tree, excluding the duplicate leaf added to pad an odd count.
+*/
+func (t *MerkleTree) LeafCount() int {
+	if t.config.store != nil {
+		return t.config.store.LeafCount()
+	}
+	count := len(t.Leaves)
+	if count > 0 && t.Leaves[count-1] != nil && t.Leaves[count-1].IsDuplicate {
+		count--
+	}
+	return count
+}
+
+func (t *MerkleTree) lookupLeaf(hash []byte) (int, bool) {
+	if t.config.store != nil {
+		return t.config.store.FindLeaf(hash)
+	}
+	if t.leafIndex == nil {
+		t.buildLeafIndex()
+	}
+	return t.leafIndex.first(hash)
+}
+
+func (t *MerkleTree) buildLeafIndex() {
+	count := t.LeafCount()
+	t.leafIndex = make(hashIndex, count)
+	for i := 0; i < count; i++ {
+		//Leaves of collapsed subtrees are gone
+		if t.Leaves[i] != nil {
+			t.leafIndex.add(t.Leaves[i].Hash, i)
 		}
-		parent = parent.Parent
-		newHash = parent.Hash
 	}
+}
 
-	return nil
+// Maps leaf hash to the indexes of leaves holding it, in ascending order. Updating a nil index is a no-op.
+type hashIndex map[string][]int
+
+func (h hashIndex) first(hash []byte) (int, bool) {
+	indexes, found := h[string(hash)]
+	if !found {
+		return -1, false
+	}
+	return indexes[0], true
+}
+
+func (h hashIndex) add(hash []byte, index int) {
+	if h == nil {
+		return
+	}
+	key := string(hash)
+	indexes := h[key]
+	pos := sort.SearchInts(indexes, index)
+	indexes = append(indexes, 0)
+	copy(indexes[pos+1:], indexes[pos:])
+	indexes[pos] = index
+	h[key] = indexes
+}
+
+func (h hashIndex) remove(hash []byte, index int) {
+	if h == nil {
+		return
+	}
+	key := string(hash)
+	indexes := h[key]
+	pos := sort.SearchInts(indexes, index)
+	if pos == len(indexes) || indexes[pos] != index {
+		return
+	}
+	indexes = append(indexes[:pos], indexes[pos+1:]...)
+	if len(indexes) == 0 {
+		delete(h, key)
+		return
+	}
+	h[key] = indexes
 }
 
 /*
@@ -231,34 +558,32 @@ Returns
   - error in case any error occurs or data not found
 */
 func (t *MerkleTree) GetMerklePath(data *[]byte) (*Proof, error) {
-	leafFound := false
-	dHash, err := t.HashFunc(*data)
+	dHash, err := t.hashLeaf(*data)
 	if err != nil {
 		return nil, err
 	}
-	var proof Proof
-	proof.Hashes = make([][]byte, t.Depth+1)
-	proof.Indexes = make([]int, t.Depth+1)
-	for _, node := range t.Leaves {
-		if bytes.Equal(node.Hash, dHash) {
-			leafFound = true
-			curHash := dHash
-			parent := node.Parent
-			for index := 0; parent != nil; index++ {
-				proof.Hashes[index] = curHash
-				if !bytes.Equal(parent.Left.Hash, curHash) { //Right Node
-					proof.Indexes[index] = 1
-				}
-				curHash = parent.Hash
-				parent = parent.Parent
-			}
-			proof.Hashes[t.Depth] = t.RootHash()
-			break
-		}
+	leafIndex, found := t.lookupLeaf(dHash)
+	if !found {
+		return nil, ErrLeafNotFound
+	}
+	if t.config.store != nil {
+		return t.storePath(leafIndex)
 	}
-	if !leafFound {
-		return nil, fmt.Errorf("data doesn't exist in the tree")
+	if err := t.ensureLevels(); err != nil {
+		return nil, err
+	}
+	var proof Proof
+	proof.Hashes = make([][]byte, 0, t.Depth+1)
+	proof.Indexes = make([]int, 0, t.Depth+1)
+	node := t.Leaves[leafIndex]
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		proof.Hashes = append(proof.Hashes, node.Hash)
+		proof.Indexes = append(proof.Indexes, parent.childPosition(node))
+		node = parent
 	}
+	proof.Hashes = append(proof.Hashes, t.RootHash())
+	proof.Indexes = append(proof.Indexes, 0)
+	proof.HashID = t.HashID
 	return &proof, nil
 }
 
@@ -273,40 +598,67 @@ Returns
   - error in case any error occurs or data not found
 */
 func (t *MerkleTree) GenerateMerkleProof(data *[]byte) (*Proof, error) {
-	leafFound := false
-
-	dHash, err := t.HashFunc(*data)
+	dHash, err := t.hashLeaf(*data)
 	if err != nil {
 		return nil, err
 	}
+	leafIndex, found := t.lookupLeaf(dHash)
+	if !found {
+		return nil, ErrLeafNotFound
+	}
+	return t.GenerateMerkleProofByIndex(leafIndex)
+}
+
+/*
+Generates merkleProof for the leaf at position index without hashing any data.
+Accepts
+  - position of the leaf, starting at 0
+
+Returns
+  - Reference to a Proof object
+  - error in case index is out of range
+*/
+func (t *MerkleTree) GenerateMerkleProofByIndex(index int) (*Proof, error) {
+	if index < 0 || index >= t.LeafCount() {
+		return nil, fmt.Errorf("%w: leaf index %d not in [0, %d)", ErrIndexOutOfRange, index, t.LeafCount())
+	}
+	if t.config.store != nil {
+		return t.storeProof(index)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return nil, err
+	}
+	leaf := t.Leaves[index]
+	if leaf == nil {
+		return nil, fmt.Errorf("%w: leaf %d is part of a collapsed subtree, use GeneratePrunedProof", ErrPruned, index)
+	}
 	var proof Proof
-	//TODO: Optimize
-	//proof.Hashes = make([][]byte, t.Depth)
+	proof.Hashes = make([][]byte, 0, t.Depth)
+	proof.Indexes = make([]int, 0, t.Depth)
+	t.appendPath(&proof, leaf)
+	proof.HashID = t.HashID
+	return &proof, nil
+}
+
+/*
+Appends to proof the sibling hashes and indexes on the path from node up to the root.
+*/
+func (t *MerkleTree) appendPath(proof *Proof, node *Node) {
+	if t.config.arity() > 2 {
+		t.appendGroupPath(proof, node)
+		return
+	}
 	//Traverse the tree upwards and get hashes and indexes required for the proof.
-	for _, node := range t.Leaves {
-		if bytes.Equal(node.Hash, dHash) {
-			leafFound = true
-			curHash := dHash
-			parent := node.Parent
-			for parent != nil {
-				if bytes.Equal(parent.Left.Hash, curHash) { //Left Node
-					proof.Hashes = append(proof.Hashes, parent.Right.Hash)
-					proof.Indexes = append(proof.Indexes, 1)
-				} else { //Right Node
-					proof.Hashes = append(proof.Hashes, parent.Left.Hash)
-					proof.Indexes = append(proof.Indexes, 0)
-				}
-				curHash = parent.Hash
-				parent = parent.Parent
-			}
-			break
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Left == node { //Left Node
+			proof.Hashes = append(proof.Hashes, parent.Right.Hash)
+			proof.Indexes = append(proof.Indexes, 1)
+		} else { //Right Node
+			proof.Hashes = append(proof.Hashes, parent.Left.Hash)
+			proof.Indexes = append(proof.Indexes, 0)
 		}
+		node = parent
 	}
-	if !leafFound {
-		return nil, fmt.Errorf("data doesn't exist in the tree")
-	}
-	//fmt.Printf("Generated Proof for has %v is %v \n", dHash, proof)
-	return &proof, nil
 }
 
 /*
@@ -321,31 +673,56 @@ Returns
 */
 func (tree *MerkleTree) VerifyProof(data *[]byte, proof *Proof) (bool, error) {
 	//fmt.Println("VerifyProof:To be implemented")
-	dHash, err := tree.HashFunc(*data)
-	if err != nil {
-		return false, err
+	if proof != nil && len(proof.Hashes) > tree.Depth {
+		return false, &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("proof with %d hashes is longer than tree depth %d", len(proof.Hashes), tree.Depth)}
 	}
-	for i, val := range proof.Hashes {
-
-		if proof.Indexes[i] == 0 {
-			dHash, err = tree.HashFunc(append(val, dHash...))
-			if err != nil {
-				return false, err
-			}
-		} else {
-			dHash, err = tree.HashFunc(append(dHash, val...))
-			if err != nil {
-				return false, err
-			}
-		}
+	verified, err := verifyProof(tree.RootHash(), *data, proof, tree.HashFunc, &tree.config)
+	var proofErr *ProofError
+	if errors.As(err, &proofErr) && proofErr.Err == ErrRootMismatch {
+		proofErr.Level = tree.divergenceLevel(*data, proof)
+		proofErr.Detail = fmt.Sprintf("proof diverges from the tree at level %d", proofErr.Level)
 	}
-	// fmt.Println("generated rootHash is ", dHash)
-	// fmt.Println("Tree's rootHash is ", t.RootHash())
+	return verified, err
+}
 
-	if !bytes.Equal(dHash, tree.RootHash()) {
-		return false, fmt.Errorf("generated root hash not matches stored root")
+/*
+Returns the height above the leaf of the first hash computed from proof that differs from the tree's own proof for data.
+*/
+func (tree *MerkleTree) divergenceLevel(data []byte, proof *Proof) int {
+	hash, err := tree.hashLeaf(data)
+	if err != nil {
+		return 0
+	}
+	index, found := tree.lookupLeaf(hash)
+	if !found {
+		return 0
+	}
+	expected, err := tree.GenerateMerkleProofByIndex(index)
+	if err != nil {
+		return 0
+	}
+	cur, want := hash, hash
+	for i, sibling := range proof.Hashes {
+		if i >= len(expected.Hashes) {
+			return i + 1
+		}
+		//Indexes may be left empty for trees built using WithSortedPairs
+		direction := 0
+		if i < len(proof.Indexes) {
+			direction = proof.Indexes[i]
+		}
+		if cur, err = tree.config.hashProofStep(tree.HashFunc, cur, sibling, direction); err != nil {
+			return i + 1
+		}
+		if want, err = tree.config.hashProofStep(tree.HashFunc, want, expected.Hashes[i], expected.Indexes[i]); err != nil {
+			return i + 1
+		}
+		if !bytes.Equal(cur, want) {
+			return i + 1
+		}
 	}
-	return true, nil
+	return len(proof.Hashes)
 }
 
 func (m *MerkleTree) String() string {
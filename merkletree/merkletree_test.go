@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"crypto/sha512"
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -108,7 +109,8 @@ func TestMerkleBasics(t *testing.T) {
 		fmt.Printf("Failed to Update Leaf node with oldValue %v due to error %v\n", data[0], err)
 		t.FailNow()
 	}
-	expectedRootHash = []byte{65, 94, 211, 81, 47, 69, 136, 19, 206, 251, 153, 39, 235, 99, 159, 208, 220, 46, 32, 181, 213, 210, 117, 140, 11, 114, 70, 5, 49, 140, 135, 45}
+	//Root of a tree built from {"Hi", "Hi", "Hey", "Hola"}
+	expectedRootHash = []byte{151, 0, 200, 33, 82, 172, 242, 20, 38, 69, 8, 54, 146, 96, 224, 217, 159, 133, 237, 174, 12, 25, 236, 16, 245, 6, 227, 125, 52, 150, 202, 224}
 	if !bytes.Equal(tree.RootHash(), expectedRootHash) {
 		fmt.Println("Root hash generated is not matching expected hash after leaf is updated")
 		t.FailNow()
@@ -117,6 +119,220 @@ func TestMerkleBasics(t *testing.T) {
 
 }
 
+func testData(count int) Data {
+	var data Data
+	for i := 0; i < count; i++ {
+		data = append(data, []byte(fmt.Sprintf("Hello%d", i)))
+	}
+	return data
+}
+
+// Checks that tree has the root, depth and leaf count of a tree freshly built from data, and returns the rebuilt tree.
+func assertRootMatchesRebuilt(t *testing.T, tree *MerkleTree, data Data, opts ...Option) *MerkleTree {
+	t.Helper()
+	expected, err := NewTree(&data, tree.HashFunc, opts...)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+		t.Fatalf("Root with %d leaves doesn't match rebuilt tree", len(data))
+	}
+	if tree.Depth != expected.Depth || tree.LeafCount() != len(data) {
+		t.Fatalf("Tree with %d leaves has depth %d and %d leaves, expected depth %d",
+			len(data), tree.Depth, tree.LeafCount(), expected.Depth)
+	}
+	return expected
+}
+
+// Checks that tree has the same structure and hashes as a tree freshly built from data.
+func assertMatchesRebuilt(t *testing.T, tree *MerkleTree, data Data, opts ...Option) {
+	t.Helper()
+	expected := assertRootMatchesRebuilt(t, tree, data, opts...)
+	if len(tree.Leaves) != len(expected.Leaves) {
+		t.Fatalf("Tree with %d leaves holds %d leaf nodes, expected %d", len(data), len(tree.Leaves), len(expected.Leaves))
+	}
+	if tree.Root.Parent != nil {
+		t.Fatalf("Root of tree with %d leaves has a parent", len(data))
+	}
+	if len(tree.levels) != len(expected.levels) {
+		t.Fatalf("Tree with %d leaves has %d levels, expected %d", len(data), len(tree.levels), len(expected.levels))
+	}
+	for level := range expected.levels {
+		if len(tree.levels[level]) != len(expected.levels[level]) {
+			t.Fatalf("Level %d has %d nodes, expected %d", level, len(tree.levels[level]), len(expected.levels[level]))
+		}
+		for i, node := range expected.levels[level] {
+			if !bytes.Equal(tree.levels[level][i].Hash, node.Hash) || tree.levels[level][i].IsDuplicate != node.IsDuplicate {
+				t.Fatalf("Node %d at level %d doesn't match rebuilt tree with %d leaves", i, level, len(data))
+			}
+		}
+	}
+	for i := range data {
+		proof, err := tree.GenerateMerkleProofByIndex(i)
+		if err != nil {
+			t.Fatalf("Failed to generate Merkle Proof for leaf %d due to error %v", i, err)
+		}
+		if verified, err := tree.VerifyProof(&data[i], proof); !verified {
+			t.Fatalf("Failed to verify Merkle Proof for leaf %d of %d due to error %v", i, len(data), err)
+		}
+	}
+}
+
+func TestMerkleProofByIndex(t *testing.T) {
+	for _, count := range []int{1, 2, 5, 6, 8, 13} {
+		data := testData(count)
+		tree, err := NewTree(&data, HashFuncSHA256)
+		if err != nil {
+			t.Fatalf("Failed to build Tree with %d leaves due to error %v", count, err)
+		}
+		if tree.LeafCount() != count {
+			t.Fatalf("Expected %d leaves, got %d", count, tree.LeafCount())
+		}
+		for i := range data {
+			byIndex, err := tree.GenerateMerkleProofByIndex(i)
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof for index %d due to error %v", i, err)
+			}
+			byData, err := tree.GenerateMerkleProof(&data[i])
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof for index %d due to error %v", i, err)
+			}
+			if len(byIndex.Hashes) != tree.Depth || len(byData.Hashes) != tree.Depth {
+				t.Fatalf("Proof length for index %d doesn't match tree depth %d", i, tree.Depth)
+			}
+			if match, err := byIndex.Equals(byData); !match {
+				t.Fatalf("Proof by index %d doesn't match proof by data due to error %v", i, err)
+			}
+			if verified, err := tree.VerifyProof(&data[i], byIndex); !verified {
+				t.Fatalf("Failed to verify Merkle Proof for index %d due to error %v", i, err)
+			}
+			path, err := tree.GetMerklePath(&data[i])
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Path for index %d due to error %v", i, err)
+			}
+			if len(path.Hashes) != tree.Depth+1 || !bytes.Equal(path.Hashes[tree.Depth], tree.RootHash()) {
+				t.Fatalf("Merkle Path for index %d doesn't end at the root", i)
+			}
+		}
+		if _, err := tree.GenerateMerkleProofByIndex(count); err == nil {
+			t.Fatalf("Expected error generating proof for out of range index %d", count)
+		}
+		if _, err := tree.GenerateMerkleProofByIndex(-1); err == nil {
+			t.Fatalf("Expected error generating proof for negative index")
+		}
+	}
+}
+
+func TestMerkleUpdateLeafAt(t *testing.T) {
+	for _, count := range []int{2, 5, 8, 11} {
+		data := testData(count)
+		tree, err := NewTree(&data, HashFuncSHA256)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		for _, i := range []int{0, count / 2, count - 1} {
+			newValue := []byte(fmt.Sprintf("Updated%d", i))
+			if err := tree.UpdateLeafAt(i, newValue); err != nil {
+				t.Fatalf("Failed to update leaf %d due to error %v", i, err)
+			}
+			data[i] = newValue
+			expected, err := NewTree(&data, HashFuncSHA256)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+				t.Fatalf("Root hash after updating leaf %d of %d doesn't match rebuilt tree", i, count)
+			}
+			proof, err := tree.GenerateMerkleProof(&newValue)
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof for updated leaf %d due to error %v", i, err)
+			}
+			if verified, err := tree.VerifyProof(&newValue, proof); !verified {
+				t.Fatalf("Failed to verify Merkle Proof for updated leaf %d due to error %v", i, err)
+			}
+		}
+		oldValue := []byte("Hello1")
+		if _, err := tree.GenerateMerkleProof(&oldValue); count > 2 && err != nil {
+			t.Fatalf("Expected untouched leaf to still be found, got error %v", err)
+		}
+		replaced := []byte("Hello0")
+		if _, err := tree.GenerateMerkleProof(&replaced); err == nil {
+			t.Fatalf("Expected replaced leaf value to no longer be found")
+		}
+		if err := tree.UpdateLeafAt(count, []byte("x")); err == nil {
+			t.Fatalf("Expected error updating out of range index %d", count)
+		}
+	}
+}
+
+func TestMerkleDuplicateLeafValues(t *testing.T) {
+	data := Data{[]byte("a"), []byte("b"), []byte("a"), []byte("c")}
+	tree, err := NewTree(&data, HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	first, _ := tree.GenerateMerkleProofByIndex(0)
+	proof, err := tree.GenerateMerkleProof(&data[0])
+	if err != nil {
+		t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+	}
+	if match, _ := proof.Equals(first); !match {
+		t.Fatalf("Expected proof for duplicated value to refer to its first leaf")
+	}
+	if err := tree.UpdateLeafAt(0, []byte("d")); err != nil {
+		t.Fatalf("Failed to update leaf due to error %v", err)
+	}
+	third, _ := tree.GenerateMerkleProofByIndex(2)
+	proof, err = tree.GenerateMerkleProof(&data[2])
+	if err != nil {
+		t.Fatalf("Expected remaining duplicate to be found, got error %v", err)
+	}
+	if match, _ := proof.Equals(third); !match {
+		t.Fatalf("Expected proof for remaining duplicate to refer to leaf 2")
+	}
+}
+
+func TestNewTreeFromLeafHashes(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithDomainSeparation(), WithOddNodePromotion()},
+		{WithSortedLeaves()},
+		{WithBranching(4), WithDomainSeparation()},
+	} {
+		for _, count := range []int{1, 2, 7, 33} {
+			data := testData(count)
+			expected, _ := NewTree(&data, HashFuncSHA256, opts...)
+			hashes := make([][]byte, count)
+			for i := range data {
+				hashes[i], _ = HashLeaf(data[i], HashFuncSHA256, opts...)
+			}
+			tree, err := NewTreeFromLeafHashes(hashes, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) || tree.Depth != expected.Depth {
+				t.Fatalf("Tree from %d leaf hashes doesn't match tree built from data", count)
+			}
+			for i := range data {
+				proof, err := tree.GenerateMerkleProof(&data[i])
+				if err != nil {
+					t.Fatalf("Failed to generate Merkle Proof for leaf %d due to error %v", i, err)
+				}
+				if verified, err := expected.VerifyProof(&data[i], proof); !verified {
+					t.Fatalf("Failed to verify Merkle Proof for leaf %d due to error %v", i, err)
+				}
+			}
+		}
+	}
+	if _, err := NewTreeFromLeafHashes(nil, HashFuncSHA256); !errors.Is(err, ErrEmptyData) {
+		t.Fatalf("Expected ErrEmptyData for no leaf hashes, got %v", err)
+	}
+	hashes := [][]byte{make([]byte, 32)}
+	if _, err := NewTreeFromLeafHashes(hashes, HashFuncSHA256, WithNodeStore(NewMemoryNodeStore())); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported building from leaf hashes in a node store, got %v", err)
+	}
+}
+
 func TestMerkleTreeAdvanced(t *testing.T) {
 	/*TODO:
 	1. Test with different hash functions
@@ -146,6 +362,8 @@ func TestMerkleTreeRareScenarios(t *testing.T) {
 var tree *MerkleTree
 var data Data
 
+var errTestHash = errors.New("test hash failure")
+
 func merkleTreeProofGen(leafCount int, b *testing.B) {
 
 	//b.ResetTimer()
@@ -178,26 +396,49 @@ func BenchmarkMerkleTreeProof5000(b *testing.B) {
 }
 
 func BenchmarkMerkleTreeBuild100(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		treeCreate(100)
-	}
+	benchmarkMerkleTreeBuild(100, b)
 }
 
 func BenchmarkMerkleTreeBuild1000(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		treeCreate(1000)
-	}
+	benchmarkMerkleTreeBuild(1000, b)
 }
 
 func BenchmarkMerkleTreeBuild5000(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		treeCreate(5000)
+	benchmarkMerkleTreeBuild(5000, b)
+}
+
+func BenchmarkMerkleTreeBuild100000(b *testing.B) {
+	benchmarkMerkleTreeBuild(100000, b)
+}
+
+// Compares sequential build against builds using WithWorkers, and HashFunction against reused digests.
+// Allocations of builds reusing digests are bounded by TestNewTreeWithHasherAllocations.
+func benchmarkMerkleTreeBuild(leafCount int, b *testing.B) {
+	treeCreate(leafCount)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewTree(&data, HashFuncSHA256, WithWorkers(workers)); err != nil {
+					b.FailNow()
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("hasher/workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewTreeWithHasher(&data, sha256.New, WithWorkers(workers)); err != nil {
+					b.FailNow()
+				}
+			}
+		})
 	}
 }
 
 func treeCreate(count int) {
 	var err error
 	str := "Hello"
+	data = nil
 	for i := 0; i < count; i++ {
 		rand := rand.Int()
 		d := []byte(fmt.Sprintf("%s%d", str, rand))
@@ -0,0 +1,422 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+)
+
+/*
+Merkle Mountain Range, an append-only accumulator made of perfect binary trees called mountains.
+Nodes are numbered in post-order starting at 0, as in Polkadot's and Nervos' MMR, Grin numbers the same way starting at 1.
+Each append adds a leaf and the parents it completes, so no node is ever rehashed.
+The root bags the peaks right to left, hashing H(right||left), so an MMR of 2^k leaves has the same root as a MerkleTree built using WithOddNodePromotion.
+*/
+type MMR struct {
+	HashFunc HashFunction
+	config   treeConfig
+	//Node hashes in position order
+	nodes [][]byte
+}
+
+/*
+Creates an empty MMR.
+Accepts
+  - Hash function to be used for hashing
+  - Optional settings changing how leaves and nodes are hashed, e.g. WithDomainSeparation
+
+Returns
+  - Reference to the MMR in case of no errors
+  - error in case hash function is insecure
+*/
+func NewMMR(hashFunc HashFunction, opts ...Option) (*MMR, error) {
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	return &MMR{HashFunc: hashFunc, config: newTreeConfig(opts)}, nil
+}
+
+/*
+Returns number of nodes in the MMR, the size proofs are generated against.
+*/
+func (m *MMR) Size() int {
+	return len(m.nodes)
+}
+
+/*
+Returns number of leaves appended to the MMR.
+*/
+func (m *MMR) LeafCount() int {
+	count, _ := mmrLeafCount(len(m.nodes))
+	return count
+}
+
+/*
+Appends a leaf along with all parents it completes.
+Accepts
+  - data for the new leaf
+
+Returns
+  - position of the leaf
+  - error in case any error occurs while hashing
+*/
+func (m *MMR) Append(data []byte) (int, error) {
+	hash, err := m.config.hashLeaf(m.HashFunc, data)
+	if err != nil {
+		return 0, err
+	}
+	leafPos := len(m.nodes)
+	pos := leafPos
+	nodes := append(m.nodes, hash)
+	//Next position is a parent as long as it is higher than the node just added
+	for height := 0; MMRHeight(pos+1) > height; height++ {
+		pos++
+		left := nodes[pos-(2<<height)]
+		hash, err = m.config.hashNode(m.HashFunc, left, hash)
+		if err != nil {
+			return 0, err
+		}
+		nodes = append(nodes, hash)
+	}
+	m.nodes = nodes
+	return leafPos, nil
+}
+
+/*
+Returns root of the MMR.
+*/
+func (m *MMR) Root() ([]byte, error) {
+	return m.RootAt(len(m.nodes))
+}
+
+/*
+Returns root the MMR had when it was of the given size.
+Accepts
+  - size of the MMR, a value returned by Size at some point
+
+Returns
+  - root hash
+  - error in case size is not a valid MMR size or larger than the MMR
+*/
+func (m *MMR) RootAt(size int) ([]byte, error) {
+	peaks, err := m.peakHashes(size)
+	if err != nil {
+		return nil, err
+	}
+	return bagPeaks(&m.config, m.HashFunc, peaks)
+}
+
+func (m *MMR) peakHashes(size int) ([][]byte, error) {
+	if size <= 0 || size > len(m.nodes) {
+		return nil, fmt.Errorf("%w: mmr size %d not in [1, %d]", ErrIndexOutOfRange, size, len(m.nodes))
+	}
+	positions, err := MMRPeaks(size)
+	if err != nil {
+		return nil, err
+	}
+	peaks := make([][]byte, len(positions))
+	for i, pos := range positions {
+		peaks[i] = m.nodes[pos]
+	}
+	return peaks, nil
+}
+
+/*
+Hashes peaks into a single root from right to left, H(right||left), as Polkadot's MMR does.
+*/
+func bagPeaks(config *treeConfig, hashFunc HashFunction, peaks [][]byte) ([]byte, error) {
+	if len(peaks) == 0 {
+		return nil, ErrEmptyData
+	}
+	bag := peaks[len(peaks)-1]
+	var err error
+	for i := len(peaks) - 2; i >= 0; i-- {
+		bag, err = config.hashNode(hashFunc, bag, peaks[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bag, nil
+}
+
+/*
+Generates proof that the node at pos is part of the MMR of the given size.
+Hashes are the siblings on the path up to the node's peak, then the bag of the peaks to its right if any,
+then the peaks to its left from right to left. Indexes are set accordingly, so the proof also verifies using VerifyProof.
+Accepts
+  - position of the leaf, as returned by Append
+  - size of the MMR to prove against, at least pos+1
+
+Returns
+  - Reference to a Proof object
+  - error in case size is invalid or doesn't contain pos
+*/
+func (m *MMR) GenerateProof(pos int, size int) (*Proof, error) {
+	if size > len(m.nodes) {
+		return nil, fmt.Errorf("%w: mmr size %d larger than %d", ErrIndexOutOfRange, size, len(m.nodes))
+	}
+	plan, err := planMMRProof(pos, size)
+	if err != nil {
+		return nil, err
+	}
+	proof := Proof{Indexes: plan.indexes}
+	for _, sibling := range plan.siblings {
+		proof.Hashes = append(proof.Hashes, m.nodes[sibling])
+	}
+	if rhs := plan.peaks[plan.peak+1:]; len(rhs) > 0 {
+		hashes := make([][]byte, len(rhs))
+		for i, peak := range rhs {
+			hashes[i] = m.nodes[peak]
+		}
+		bag, err := bagPeaks(&m.config, m.HashFunc, hashes)
+		if err != nil {
+			return nil, err
+		}
+		proof.Hashes = append(proof.Hashes, bag)
+	}
+	for i := plan.peak - 1; i >= 0; i-- {
+		proof.Hashes = append(proof.Hashes, m.nodes[plan.peaks[i]])
+	}
+	return &proof, nil
+}
+
+/*
+Verifies proof that data is the leaf at pos of an MMR of the given size with the trusted root.
+Unlike VerifyProof, the shape of the proof is checked against pos and size, so a leaf can't be proven at another position.
+Accepts
+  - trusted root of the MMR
+  - size of the MMR the root is for
+  - position of the leaf
+  - data of the leaf
+  - Proof generated using GenerateProof
+  - Hash function and options the MMR was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed or doesn't lead to root, error from hash function otherwise
+*/
+func VerifyMMRProof(root []byte, size int, pos int, data []byte, proof *Proof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config := newTreeConfig(opts)
+	if MMRHeight(pos) != 0 {
+		return false, malformedProof("position %d is not a leaf", pos)
+	}
+	hash, err := config.hashLeaf(hashFunc, data)
+	if err != nil {
+		return false, err
+	}
+	return verifyMMRNode(root, size, pos, hash, proof, hashFunc, &config)
+}
+
+func verifyMMRNode(root []byte, size int, pos int, hash []byte, proof *Proof, hashFunc HashFunction, config *treeConfig) (bool, error) {
+	if proof == nil {
+		return false, malformedProof("proof is nil")
+	}
+	if err := proof.validate(); err != nil {
+		return false, err
+	}
+	plan, err := planMMRProof(pos, size)
+	if err != nil {
+		return false, malformedProof("%v", err)
+	}
+	if len(plan.indexes) != len(proof.Indexes) {
+		return false, malformedProof("proof has %d hashes, expected %d for position %d of mmr size %d",
+			len(proof.Hashes), len(plan.indexes), pos, size)
+	}
+	for i, index := range plan.indexes {
+		if proof.Indexes[i] != index {
+			return false, malformedProof("index %d at %d doesn't match position %d", proof.Indexes[i], i, pos)
+		}
+	}
+	return verifyProofFromLeafHash(root, hash, proof, hashFunc, config)
+}
+
+// Positions making up the proof of a node
+type mmrProofPlan struct {
+	//Positions of siblings on the path from the node to its peak
+	siblings []int
+	//Peak positions of the MMR and index of the one above the node
+	peaks []int
+	peak  int
+	//Indexes of the whole proof, including peaks
+	indexes []int
+}
+
+func planMMRProof(pos int, size int) (mmrProofPlan, error) {
+	var plan mmrProofPlan
+	if pos < 0 || pos >= size {
+		return plan, fmt.Errorf("%w: position %d not in mmr of size %d", ErrIndexOutOfRange, pos, size)
+	}
+	peaks, err := MMRPeaks(size)
+	if err != nil {
+		return plan, err
+	}
+	plan.peaks = peaks
+	for plan.peak = 0; peaks[plan.peak] < pos; plan.peak++ {
+	}
+	peak := peaks[plan.peak]
+	height := MMRHeight(pos)
+	for pos < peak {
+		if MMRHeight(pos+1) > height {
+			//Right child, parent follows it
+			plan.siblings = append(plan.siblings, pos-(2<<height)+1)
+			plan.indexes = append(plan.indexes, 0)
+			pos++
+		} else {
+			sibling := pos + (2 << height) - 1
+			plan.siblings = append(plan.siblings, sibling)
+			plan.indexes = append(plan.indexes, 1)
+			pos = sibling + 1
+		}
+		height++
+	}
+	if plan.peak < len(peaks)-1 {
+		//Bag of the peaks to the right is hashed first, H(right||left)
+		plan.indexes = append(plan.indexes, 0)
+	}
+	for i := 0; i < plan.peak; i++ {
+		plan.indexes = append(plan.indexes, 1)
+	}
+	return plan, nil
+}
+
+/*
+Proof that the MMR of OldSize is a prefix of the MMR of NewSize.
+It holds the peaks of the old MMR, which bag to the old root, and a proof for each of them in the new MMR.
+*/
+type MMRAncestryProof struct {
+	OldSize    int
+	NewSize    int
+	OldPeaks   [][]byte
+	PeakProofs []*Proof
+}
+
+/*
+Generates proof that the MMR of oldSize is an ancestor of the MMR of newSize.
+Accepts
+  - size of the older MMR
+  - size of the newer MMR, at least oldSize
+
+Returns
+  - Reference to a MMRAncestryProof object
+  - error in case any size is invalid
+*/
+func (m *MMR) GenerateAncestryProof(oldSize int, newSize int) (*MMRAncestryProof, error) {
+	if oldSize > newSize {
+		return nil, fmt.Errorf("%w: invalid mmr sizes %d and %d", ErrIndexOutOfRange, oldSize, newSize)
+	}
+	oldPeaks, err := m.peakHashes(oldSize)
+	if err != nil {
+		return nil, err
+	}
+	positions, _ := MMRPeaks(oldSize)
+	proof := MMRAncestryProof{OldSize: oldSize, NewSize: newSize, OldPeaks: oldPeaks}
+	for _, pos := range positions {
+		peakProof, err := m.GenerateProof(pos, newSize)
+		if err != nil {
+			return nil, err
+		}
+		proof.PeakProofs = append(proof.PeakProofs, peakProof)
+	}
+	return &proof, nil
+}
+
+/*
+Verifies that the MMR with oldRoot is an ancestor of the MMR with newRoot.
+Accepts
+  - trusted roots of the older and newer MMR
+  - MMRAncestryProof object
+  - Hash function and options the MMR was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed or doesn't lead to the roots, error from hash function otherwise
+*/
+func VerifyMMRAncestry(oldRoot []byte, newRoot []byte, proof *MMRAncestryProof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config := newTreeConfig(opts)
+	if proof == nil {
+		return false, malformedProof("proof is nil")
+	}
+	if proof.OldSize > proof.NewSize {
+		return false, malformedProof("invalid mmr sizes %d and %d", proof.OldSize, proof.NewSize)
+	}
+	positions, err := MMRPeaks(proof.OldSize)
+	if err != nil {
+		return false, malformedProof("%v", err)
+	}
+	if len(proof.OldPeaks) != len(positions) || len(proof.PeakProofs) != len(positions) {
+		return false, malformedProof("%d peaks and %d proofs for mmr of size %d with %d peaks",
+			len(proof.OldPeaks), len(proof.PeakProofs), proof.OldSize, len(positions))
+	}
+	bag, err := bagPeaks(&config, hashFunc, proof.OldPeaks)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(bag, oldRoot) {
+		return false, &ProofError{Err: ErrRootMismatch, Detail: "old peaks don't bag to old root"}
+	}
+	for i, pos := range positions {
+		if ok, err := verifyMMRNode(newRoot, proof.NewSize, pos, proof.OldPeaks[i], proof.PeakProofs[i], hashFunc, &config); !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+/*
+Returns size of an MMR holding leafCount leaves.
+*/
+func MMRSize(leafCount int) int {
+	return 2*leafCount - bits.OnesCount(uint(leafCount))
+}
+
+/*
+Returns position of the leaf at leafIndex, counting leaves from 0.
+*/
+func MMRLeafPosition(leafIndex int) int {
+	return MMRSize(leafIndex+1) - bits.TrailingZeros(uint(leafIndex+1)) - 1
+}
+
+/*
+Returns height of the node at pos, leaves being at height 0.
+*/
+func MMRHeight(pos int) int {
+	//With 1 based positions, peaks of the left most mountains are all ones in binary
+	p := uint(pos + 1)
+	for bits.OnesCount(p) != bits.Len(p) {
+		//Jump to the node at the same height in the mountain to the left
+		p -= 1<<(bits.Len(p)-1) - 1
+	}
+	return bits.Len(p) - 1
+}
+
+/*
+Returns positions of the peaks of an MMR of the given size, from left to right.
+*/
+func MMRPeaks(size int) ([]int, error) {
+	var peaks []int
+	offset := 0
+	for height := bits.Len(uint(size+1)) - 1; height >= 0; height-- {
+		mountain := 2<<height - 1
+		if size-offset >= mountain {
+			offset += mountain
+			peaks = append(peaks, offset-1)
+		}
+	}
+	if offset != size || size == 0 {
+		return nil, fmt.Errorf("%w: %d is not a valid mmr size", ErrIndexOutOfRange, size)
+	}
+	return peaks, nil
+}
+
+func mmrLeafCount(size int) (int, error) {
+	peaks, err := MMRPeaks(size)
+	if err != nil {
+		return 0, err
+	}
+	count, prev := 0, -1
+	for _, peak := range peaks {
+		count += (peak - prev + 1) / 2
+		prev = peak
+	}
+	return count, nil
+}
@@ -0,0 +1,130 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMMRPositions(t *testing.T) {
+	//Values from the Nervos/Polkadot MMR implementation
+	positions := []int{0, 1, 3, 4, 7, 8, 10, 11, 15}
+	for i, pos := range positions {
+		if MMRLeafPosition(i) != pos {
+			t.Fatalf("Leaf %d is at position %d, expected %d", i, MMRLeafPosition(i), pos)
+		}
+	}
+	heights := []int{0, 0, 1, 0, 0, 1, 2, 0, 0, 1, 0, 0, 1, 2, 3, 0}
+	for pos, height := range heights {
+		if MMRHeight(pos) != height {
+			t.Fatalf("Position %d has height %d, expected %d", pos, MMRHeight(pos), height)
+		}
+	}
+	peaks := map[int][]int{1: {0}, 3: {2}, 4: {2, 3}, 7: {6}, 8: {6, 7}, 10: {6, 9}, 11: {6, 9, 10}, 19: {14, 17, 18}}
+	for size, expected := range peaks {
+		got, err := MMRPeaks(size)
+		if err != nil || !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Peaks of size %d are %v, expected %v", size, got, expected)
+		}
+	}
+	for _, size := range []int{0, 2, 5, 6, 9} {
+		if _, err := MMRPeaks(size); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Fatalf("Expected ErrIndexOutOfRange for invalid mmr size %d, got %v", size, err)
+		}
+	}
+}
+
+func TestMMRAppendAndProofs(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithDomainSeparation()}} {
+		mmr, err := NewMMR(HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create MMR due to error %v", err)
+		}
+		data := testData(40)
+		var sizes []int
+		for i := range data {
+			pos, err := mmr.Append(data[i])
+			if err != nil {
+				t.Fatalf("Failed to append leaf due to error %v", err)
+			}
+			if pos != MMRLeafPosition(i) || mmr.Size() != MMRSize(i+1) || mmr.LeafCount() != i+1 {
+				t.Fatalf("Leaf %d appended at %d with size %d", i, pos, mmr.Size())
+			}
+			sizes = append(sizes, mmr.Size())
+			//Single mountain is a perfect tree
+			if (i+1)&i == 0 {
+				leaves := data[:i+1]
+				tree, _ := NewTree(&leaves, HashFuncSHA256, append([]Option{WithOddNodePromotion()}, opts...)...)
+				root, _ := mmr.Root()
+				if !bytes.Equal(root, tree.RootHash()) {
+					t.Fatalf("Root of %d leaves doesn't match MerkleTree", i+1)
+				}
+			}
+		}
+		for _, size := range []int{sizes[0], sizes[6], sizes[20], sizes[39]} {
+			root, err := mmr.RootAt(size)
+			if err != nil {
+				t.Fatalf("Failed to get root due to error %v", err)
+			}
+			count, _ := mmrLeafCount(size)
+			for i := 0; i < count; i++ {
+				pos := MMRLeafPosition(i)
+				proof, err := mmr.GenerateProof(pos, size)
+				if err != nil {
+					t.Fatalf("Failed to generate proof due to error %v", err)
+				}
+				if ok, err := VerifyMMRProof(root, size, pos, data[i], proof, HashFuncSHA256, opts...); !ok {
+					t.Fatalf("Failed to verify proof for leaf %d of size %d due to error %v", i, size, err)
+				}
+				if ok, err := VerifyProof(root, data[i], proof, HashFuncSHA256, opts...); !ok {
+					t.Fatalf("Failed to verify MMR proof as a plain proof due to error %v", err)
+				}
+				if ok, err := VerifyMMRProof(root, size, pos, []byte("wrong"), proof, HashFuncSHA256, opts...); ok || !errors.Is(err, ErrRootMismatch) {
+					t.Fatalf("Expected root mismatch for wrong data, got %v", err)
+				}
+				if i > 0 {
+					if ok, err := VerifyMMRProof(root, size, MMRLeafPosition(i-1), data[i], proof, HashFuncSHA256, opts...); ok {
+						t.Fatalf("Expected proof for leaf %d to fail at position of leaf %d, got %v", i, i-1, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMMRAncestry(t *testing.T) {
+	mmr, _ := NewMMR(HashFuncSHA256)
+	data := testData(25)
+	var sizes []int
+	for i := range data {
+		mmr.Append(data[i])
+		sizes = append(sizes, mmr.Size())
+	}
+	newRoot, _ := mmr.Root()
+	for _, oldSize := range sizes {
+		oldRoot, _ := mmr.RootAt(oldSize)
+		proof, err := mmr.GenerateAncestryProof(oldSize, mmr.Size())
+		if err != nil {
+			t.Fatalf("Failed to generate ancestry proof due to error %v", err)
+		}
+		if ok, err := VerifyMMRAncestry(oldRoot, newRoot, proof, HashFuncSHA256); !ok {
+			t.Fatalf("Failed to verify ancestry of size %d due to error %v", oldSize, err)
+		}
+	}
+	other, _ := NewMMR(HashFuncSHA256)
+	for i := range data[:10] {
+		other.Append([]byte{byte(i)})
+	}
+	forgedRoot, _ := other.Root()
+	proof, _ := mmr.GenerateAncestryProof(sizes[9], mmr.Size())
+	if ok, err := VerifyMMRAncestry(forgedRoot, newRoot, proof, HashFuncSHA256); ok || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected unrelated MMR to fail ancestry check, got %v", err)
+	}
+	if _, err := mmr.GenerateAncestryProof(5, mmr.Size()); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange for invalid mmr size, got %v", err)
+	}
+	if _, err := mmr.GenerateAncestryProof(mmr.Size(), 1); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange for old size larger than new size, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+/*
+Proof for multiple leaves of the same tree.
+Sibling hashes shared between the leaves or computable from them are included only once, or not at all.
+*/
+type MultiProof struct {
+	//Positions of the proven leaves in ascending order, starting at 0
+	Indices []int
+	//Number of leaves in the tree, which determines its shape
+	LeafCount int
+	//Hashes not computable from the proven leaves, ordered level by level from the leaves and by position within a level
+	Hashes [][]byte
+}
+
+/*
+Generates a single proof for the leaves at the given positions.
+Accepts
+  - positions of the leaves, in any order. Duplicates are ignored.
+
+Returns
+  - Reference to a MultiProof object
+  - error in case no positions are passed or any of them is out of range
+*/
+func (t *MerkleTree) GenerateMultiProof(indices []int) (*MultiProof, error) {
+	if err := t.requireBinary("multiproofs"); err != nil {
+		return nil, err
+	}
+	leafCount := t.LeafCount()
+	known, err := normalizeIndices(indices, leafCount)
+	if err != nil {
+		return nil, err
+	}
+	proof := MultiProof{Indices: append([]int(nil), known...), LeafCount: leafCount}
+	size := leafCount
+	for level := 0; level < t.Depth; level++ {
+		parents := make([]int, 0, len(known))
+		for k := 0; k < len(known); k++ {
+			i := known[k]
+			sibling := i ^ 1
+			if k+1 < len(known) && known[k+1] == sibling {
+				k++
+			} else if sibling < size {
+				hash, err := t.nodeHash(level, sibling)
+				if err != nil {
+					return nil, err
+				}
+				proof.Hashes = append(proof.Hashes, hash)
+			}
+			parents = append(parents, i/2)
+		}
+		known = parents
+		size = (size + 1) / 2
+	}
+	return &proof, nil
+}
+
+func normalizeIndices(indices []int, leafCount int) ([]int, error) {
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("%w: no leaf indexes passed", ErrEmptyData)
+	}
+	sorted := append([]int(nil), indices...)
+	sort.Ints(sorted)
+	unique := sorted[:0]
+	for i, index := range sorted {
+		if index < 0 || index >= leafCount {
+			return nil, fmt.Errorf("%w: leaf index %d not in [0, %d)", ErrIndexOutOfRange, index, leafCount)
+		}
+		if i == 0 || index != sorted[i-1] {
+			unique = append(unique, index)
+		}
+	}
+	return unique, nil
+}
+
+/*
+Verifies if the multi proof for the leaves is valid against the tree's root.
+Accepts
+  - data of the proven leaves in the order of proof.Indices
+  - MultiProof object generated for the leaves
+
+Returns
+  - true if proof is valid
+  - error in case of errors
+*/
+func (t *MerkleTree) VerifyMultiProof(leaves [][]byte, proof *MultiProof) (bool, error) {
+	return verifyMultiProof(t.RootHash(), leaves, proof, t.HashFunc, &t.config)
+}
+
+/*
+Verifies a multi proof against a trusted root hash without requiring the tree.
+Options should be the same ones the tree was built with.
+Accepts
+  - trusted root hash of the tree
+  - data of the proven leaves in the order of proof.Indices
+  - MultiProof object generated for the leaves
+  - Hash function the tree was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed or doesn't lead to root, ErrUnsupported if options select a k-ary tree,
+    error from hash function otherwise
+*/
+func VerifyMultiProof(root []byte, leaves [][]byte, proof *MultiProof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config := newTreeConfig(opts)
+	if err := config.requireBinary("multiproofs"); err != nil {
+		return false, err
+	}
+	return verifyMultiProof(root, leaves, proof, hashFunc, &config)
+}
+
+func verifyMultiProof(root []byte, leaves [][]byte, proof *MultiProof, hashFunc HashFunction, config *treeConfig) (bool, error) {
+	if err := proof.validate(len(leaves)); err != nil {
+		return false, err
+	}
+	known := append([]int(nil), proof.Indices...)
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		var err error
+		if hashes[i], err = config.hashLeaf(hashFunc, leaf); err != nil {
+			return false, err
+		}
+	}
+	next := 0
+	size := proof.LeafCount
+	for level := config.depth(proof.LeafCount); level > 0; level-- {
+		parents := known[:0]
+		parentHashes := hashes[:0]
+		for k := 0; k < len(known); k++ {
+			i, hash := known[k], hashes[k]
+			sibling := i ^ 1
+			var parent []byte
+			var err error
+			switch {
+			case k+1 < len(known) && known[k+1] == sibling:
+				parent, err = config.hashNode(hashFunc, hash, hashes[k+1])
+				k++
+			case sibling >= size && config.promoteOddNodes:
+				parent = hash
+			case sibling >= size:
+				parent, err = config.hashNode(hashFunc, hash, hash)
+			case next == len(proof.Hashes):
+				return false, &ProofError{Err: ErrMalformedProof, Detail: "not enough hashes in multi proof"}
+			case i%2 == 0:
+				parent, err = config.hashNode(hashFunc, hash, proof.Hashes[next])
+				next++
+			default:
+				parent, err = config.hashNode(hashFunc, proof.Hashes[next], hash)
+				next++
+			}
+			if err != nil {
+				return false, err
+			}
+			parents = append(parents, i/2)
+			parentHashes = append(parentHashes, parent)
+		}
+		known, hashes = parents, parentHashes
+		size = (size + 1) / 2
+	}
+	if next != len(proof.Hashes) {
+		return false, &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("%d unused hashes in multi proof", len(proof.Hashes)-next)}
+	}
+	if !bytes.Equal(hashes[0], root) {
+		return false, &ProofError{Err: ErrRootMismatch, Level: config.depth(proof.LeafCount)}
+	}
+	return true, nil
+}
+
+func (p *MultiProof) validate(leafCount int) error {
+	if p == nil {
+		return &ProofError{Err: ErrMalformedProof, Detail: "proof is nil"}
+	}
+	if len(p.Indices) == 0 || len(p.Indices) != leafCount {
+		return &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("%d leaves passed for %d indexes", leafCount, len(p.Indices))}
+	}
+	for i, index := range p.Indices {
+		if index < 0 || index >= p.LeafCount || (i > 0 && index <= p.Indices[i-1]) {
+			return &ProofError{Err: ErrMalformedProof,
+				Detail: fmt.Sprintf("indexes must be ascending and within [0, %d)", p.LeafCount)}
+		}
+	}
+	return nil
+}
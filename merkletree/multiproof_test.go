@@ -0,0 +1,99 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestMultiProof(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}, {WithDomainSeparation(), WithOddNodePromotion()}} {
+		for _, count := range []int{1, 2, 3, 5, 8, 13, 32, 100} {
+			data := testData(count)
+			tree, err := NewTree(&data, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			for trial := 0; trial < 20; trial++ {
+				indices := rand.Perm(count)[:1+rand.Intn(count)]
+				proof, err := tree.GenerateMultiProof(indices)
+				if err != nil {
+					t.Fatalf("Failed to generate multi proof due to error %v", err)
+				}
+				var leaves [][]byte
+				individual := 0
+				for _, i := range proof.Indices {
+					leaves = append(leaves, data[i])
+					single, _ := tree.GenerateMerkleProofByIndex(i)
+					individual += len(single.Hashes)
+				}
+				if len(proof.Hashes) > individual {
+					t.Fatalf("Multi proof has %d hashes, more than %d in individual proofs", len(proof.Hashes), individual)
+				}
+				if verified, err := tree.VerifyMultiProof(leaves, proof); !verified {
+					t.Fatalf("Failed to verify multi proof for %v of %d leaves due to error %v", proof.Indices, count, err)
+				}
+				if verified, err := VerifyMultiProof(tree.RootHash(), leaves, proof, HashFuncSHA256, opts...); !verified {
+					t.Fatalf("Failed to verify multi proof against root due to error %v", err)
+				}
+				leaves[0] = []byte("tampered")
+				if verified, err := tree.VerifyMultiProof(leaves, proof); verified || !errors.Is(err, ErrRootMismatch) {
+					t.Fatalf("Expected ErrRootMismatch for tampered leaf, got %t, %v", verified, err)
+				}
+			}
+		}
+	}
+}
+
+func TestMultiProofSize(t *testing.T) {
+	data := testData(8)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+
+	all := []int{7, 6, 5, 4, 3, 2, 1, 0}
+	proof, _ := tree.GenerateMultiProof(all)
+	if len(proof.Hashes) != 0 {
+		t.Fatalf("Expected no hashes when proving all leaves, got %d", len(proof.Hashes))
+	}
+	proof, _ = tree.GenerateMultiProof([]int{0, 1, 1})
+	if len(proof.Indices) != 2 || len(proof.Hashes) != 2 {
+		t.Fatalf("Expected 2 deduplicated indexes and 2 hashes for siblings, got %v", proof)
+	}
+	if !bytes.Equal(proof.Hashes[0], tree.Root.Left.Right.Hash) || !bytes.Equal(proof.Hashes[1], tree.Root.Right.Hash) {
+		t.Fatalf("Unexpected hashes in multi proof for siblings")
+	}
+}
+
+func TestMultiProofInvalid(t *testing.T) {
+	data := testData(10)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	if _, err := tree.GenerateMultiProof(nil); err == nil {
+		t.Fatalf("Expected error generating multi proof without indexes")
+	}
+	if _, err := tree.GenerateMultiProof([]int{1, 10}); err == nil {
+		t.Fatalf("Expected error generating multi proof with out of range index")
+	}
+	proof, _ := tree.GenerateMultiProof([]int{2, 7})
+	leaves := [][]byte{data[2], data[7]}
+	if verified, err := tree.VerifyMultiProof(leaves[:1], proof); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for missing leaf, got %t, %v", verified, err)
+	}
+	short := *proof
+	short.Hashes = short.Hashes[1:]
+	if verified, err := tree.VerifyMultiProof(leaves, &short); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for missing hashes, got %t, %v", verified, err)
+	}
+	long := *proof
+	long.Hashes = append(append([][]byte{}, long.Hashes...), long.Hashes[0])
+	if verified, err := tree.VerifyMultiProof(leaves, &long); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for extra hashes, got %t, %v", verified, err)
+	}
+	if verified, err := VerifyMultiProof(tree.RootHash(), leaves, proof, HashFuncSHA256, WithBranching(4)); verified || !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported verifying multi proof as a 4-ary tree, got %t, %v", verified, err)
+	}
+	unordered := *proof
+	unordered.Indices = []int{7, 2}
+	if verified, err := tree.VerifyMultiProof(leaves, &unordered); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for unordered indexes, got %t, %v", verified, err)
+	}
+}
@@ -10,6 +10,10 @@ type Node struct {
 	IsLeaf      bool
 	IsDuplicate bool
 	Data        []byte
+	//Children of a node of a k-ary tree, in order, with Left and Right being the first and last. Nil in binary trees.
+	Children []*Node
+	//Set on a leaf whose data is dropped by Prune, or a node whose subtree is collapsed into its hash
+	IsPruned bool
 	//TODO: Add Path metadata
 }
 
@@ -19,6 +23,24 @@ func (n *Node) String() string {
 	return fmtNode
 }
 
+/*
+Returns the position of child among the children of n, 0 for Left and 1 for Right in a binary tree.
+*/
+func (n *Node) childPosition(child *Node) int {
+	if n.Children == nil {
+		if n.Left == child {
+			return 0
+		}
+		return 1
+	}
+	for i, c := range n.Children {
+		if c == child {
+			return i
+		}
+	}
+	return -1
+}
+
 /* func (n *Node) Draw() *drawer.Drawer {
 	drawer.NewDrawer()
 	n.Hash
@@ -0,0 +1,5 @@
+//go:build !race
+
+package merkletree
+
+const raceEnabled = false
@@ -0,0 +1,124 @@
+package merkletree
+
+/*
+Defines an optional setting that can be passed while building a merkle tree.
+Options are applied in the order they are passed.
+*/
+type Option func(*treeConfig)
+
+// Largest branching factor accepted by WithBranching
+const MaxBranching = 256
+
+type treeConfig struct {
+	domainSeparation bool
+	promoteOddNodes  bool
+	workers          int
+	store            NodeStore
+	sortedLeaves     bool
+	sortedPairs      bool
+	lazyLevels       bool
+	branching        int
+	//Set by NewTreeWithHasher
+	digests *digestPool
+}
+
+/*
+Hashes leaves as H(0x00||data) and non-leaf nodes as H(0x01||left||right) as described in RFC 6962.
+Prefixing makes it impossible to present a non-leaf node as a leaf, which prevents second preimage attacks.
+On its own the last node of an odd level is still paired with a copy of itself, so roots match RFC 6962 only for
+power of 2 leaf counts, use WithRFC6962 for roots matching Certificate Transparency logs for any number of leaves.
+*/
+func WithDomainSeparation() Option {
+	return func(c *treeConfig) {
+		c.domainSeparation = true
+	}
+}
+
+/*
+Builds trees as described in RFC 6962, combining WithDomainSeparation and WithOddNodePromotion,
+so that roots and proofs match Certificate Transparency logs for any number of leaves.
+*/
+func WithRFC6962() Option {
+	return func(c *treeConfig) {
+		c.domainSeparation = true
+		c.promoteOddNodes = true
+	}
+}
+
+/*
+Carries an unpaired node at the end of a level up to the next level unchanged, instead of pairing it with a duplicate of itself.
+Without this option the data lists [a,b,c] and [a,b,c,c] produce the same root, see CVE-2012-2459.
+Proofs for leaves that get promoted are shorter as no sibling hash is needed for the levels they skip.
+Combined with WithDomainSeparation, roots match RFC 6962 for any number of leaves.
+*/
+func WithOddNodePromotion() Option {
+	return func(c *treeConfig) {
+		c.promoteOddNodes = true
+	}
+}
+
+/*
+Hashes leaves and builds each level using up to workers goroutines, each working on a contiguous range of subtrees.
+The root is identical to the one built sequentially. Hash function must be safe for concurrent use.
+Values below 2 build the tree sequentially, which is the default.
+*/
+func WithWorkers(workers int) Option {
+	return func(c *treeConfig) {
+		c.workers = workers
+	}
+}
+
+/*
+Orders leaves by their hash, so the same set of data produces the same root in whichever order it is passed.
+Leaves appended or updated later are moved to their sorted position, hence leaf positions can change after any modification.
+Combine with WithSortedPairs so that proofs can be verified without knowing the position of the leaf.
+*/
+func WithSortedLeaves() Option {
+	return func(c *treeConfig) {
+		c.sortedLeaves = true
+	}
+}
+
+/*
+Hashes every pair of nodes with the smaller hash first, as done by OpenZeppelin's MerkleProof.
+Verifying a proof then needs only the sibling hashes, Indexes of the proof are ignored and can be left empty.
+*/
+func WithSortedPairs() Option {
+	return func(c *treeConfig) {
+		c.sortedPairs = true
+	}
+}
+
+/*
+Makes ReadTree load only the leaf hashes of snapshots without interior levels.
+Levels are rebuilt and checked against the stored root on the first operation needing them,
+which returns an error wrapping ErrCorruptedSnapshot if they don't match. RootHash is available right away.
+*/
+func WithLazyLevels() Option {
+	return func(c *treeConfig) {
+		c.lazyLevels = true
+	}
+}
+
+/*
+Builds a k-ary tree where every non-leaf node has up to branching children, hashed as H(c1||...||ck).
+A level whose node count isn't a multiple of branching pads its last group with copies of its last node,
+or with WithOddNodePromotion hashes only the nodes present and promotes a lone node unchanged.
+Each entry of a proof holds the concatenated hashes of all siblings at that level, and its index is the position
+of the node among them, so proofs are k-1 hashes wide but only ceil(log_k(n)) levels deep.
+Values below 3 build a binary tree, which is the default. It can't be combined with WithNodeStore or WithSortedPairs,
+and multiproofs, consistency proofs and snapshots are only available for binary trees.
+*/
+func WithBranching(branching int) Option {
+	return func(c *treeConfig) {
+		c.branching = branching
+	}
+}
+
+func newTreeConfig(opts []Option) treeConfig {
+	var config treeConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
@@ -0,0 +1,40 @@
+package merkletree
+
+import "sync"
+
+// Levels with fewer nodes than this are hashed sequentially as goroutine overhead outweighs the gain.
+const minParallelNodes = 256
+
+/*
+Runs fn over [0, count) split into contiguous chunks, one goroutine per chunk.
+Chunk boundaries are multiples of align so that pairs of nodes are never split.
+Returns the first error returned by fn.
+*/
+func parallelFor(count int, workers int, align int, fn func(start, end int) error) error {
+	chunk := (count + workers - 1) / workers
+	chunk = (chunk + align - 1) / align * align
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w, start := 0, 0; start < count; w, start = w+1, start+chunk {
+		end := start + chunk
+		if end > count {
+			end = count
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			errs[w] = fn(start, end)
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *treeConfig) parallel(count int) bool {
+	return c.workers > 1 && count >= minParallelNodes
+}
@@ -0,0 +1,41 @@
+package merkletree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParallelBuildMatchesSequential(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}, {WithDomainSeparation(), WithOddNodePromotion()}} {
+		for _, count := range []int{1, 255, 256, 1000, 4097} {
+			data := testData(count)
+			sequential, err := NewTree(&data, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			for _, workers := range []int{2, 3, 8, 64} {
+				parallel, err := NewTree(&data, HashFuncSHA256, append(opts, WithWorkers(workers))...)
+				if err != nil {
+					t.Fatalf("Failed to build Tree with %d workers due to error %v", workers, err)
+				}
+				if !bytes.Equal(parallel.RootHash(), sequential.RootHash()) {
+					t.Fatalf("Root with %d workers and %d leaves doesn't match sequential build", workers, count)
+				}
+				assertMatchesRebuilt(t, parallel, data, opts...)
+			}
+		}
+	}
+}
+
+func TestParallelBuildHashError(t *testing.T) {
+	failing := func(data []byte) ([]byte, error) {
+		if bytes.HasPrefix(data, []byte("Hello7")) {
+			return nil, errTestHash
+		}
+		return HashFuncSHA256(data)
+	}
+	data := testData(1000)
+	if _, err := NewTree(&data, failing, WithWorkers(4)); err != errTestHash {
+		t.Fatalf("Expected hash function error from parallel build, got %v", err)
+	}
+}
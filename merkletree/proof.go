@@ -6,8 +6,14 @@ import (
 )
 
 type Proof struct {
-	Hashes  [][]byte
+	//Sibling hashes from the leaf up. For a k-ary tree each entry holds the hashes of all siblings at that level back to back.
+	Hashes [][]byte
+	//Position of the node at each level, 0 meaning the sibling is on the left in a binary tree.
 	Indexes []int
+	//Hash function of the tree the proof is generated from, HashUnknown if it isn't a registered one.
+	HashID HashID
+	//Branching factor of the k-ary tree the proof is generated from, 0 for a binary tree.
+	Branching int
 }
 
 func (p *Proof) Equals(p1 *Proof) (bool, error) {
@@ -21,3 +27,73 @@ func (p *Proof) Equals(p1 *Proof) (bool, error) {
 	}
 	return true, nil
 }
+
+/*
+Verifies a merkle proof against a trusted root hash without requiring the tree.
+Options should be the same ones the tree was built with, e.g. WithDomainSeparation.
+Accepts
+  - trusted root hash of the tree
+  - the data for which proof is generated
+  - Proof object indicating merkle proof
+  - Hash function the tree was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed or doesn't lead to root, error from hash function otherwise
+*/
+func VerifyProof(root []byte, leafData []byte, proof *Proof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config := newTreeConfig(opts)
+	return verifyProof(root, leafData, proof, hashFunc, &config)
+}
+
+func verifyProof(root []byte, leafData []byte, proof *Proof, hashFunc HashFunction, config *treeConfig) (bool, error) {
+	if proof == nil {
+		return false, &ProofError{Err: ErrMalformedProof, Detail: "proof is nil"}
+	}
+	if config.sortedPairs && len(proof.Indexes) == 0 {
+		//Direction doesn't matter as pairs are hashed in sorted order
+		proof = &Proof{Hashes: proof.Hashes, Indexes: make([]int, len(proof.Hashes))}
+	}
+	if err := proof.validateBranching(config.arity()); err != nil {
+		return false, err
+	}
+	if proof.Branching != 0 && proof.Branching != config.arity() {
+		return false, malformedProof("proof is of a tree with branching factor %d, expected %d", proof.Branching, config.arity())
+	}
+	dHash, err := config.hashLeaf(hashFunc, leafData)
+	if err != nil {
+		return false, err
+	}
+	return verifyProofFromLeafHash(root, dHash, proof, hashFunc, config)
+}
+
+/*
+Verifies proof starting from an already computed leaf hash. Proof must have been validated.
+*/
+func verifyProofFromLeafHash(root []byte, dHash []byte, proof *Proof, hashFunc HashFunction, config *treeConfig) (bool, error) {
+	var err error
+	for i, val := range proof.Hashes {
+		dHash, err = config.hashProofStep(hashFunc, dHash, val, proof.Indexes[i])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !bytes.Equal(dHash, root) {
+		return false, &ProofError{Err: ErrRootMismatch, Level: len(proof.Hashes)}
+	}
+	return true, nil
+}
+
+/*
+Hashes cur with the sibling hash from a proof, index 0 meaning the sibling is on the left.
+*/
+func (c *treeConfig) hashProofStep(hashFunc HashFunction, cur []byte, sibling []byte, index int) ([]byte, error) {
+	if c.arity() > 2 {
+		return c.hashGroupStep(hashFunc, cur, sibling, index)
+	}
+	if index == 0 {
+		return c.hashNode(hashFunc, sibling, cur)
+	}
+	return c.hashNode(hashFunc, cur, sibling)
+}
@@ -0,0 +1,363 @@
+package merkletree
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	//Version of the binary proof encoding, written as the first byte. Version 1, without hash id, is still decoded.
+	ProofEncodingVersion byte = 2
+	//Version of the binary proof encoding written for proofs of k-ary trees, holding the branching factor and a position per level.
+	KaryProofEncodingVersion byte = 3
+	//Max number of hashes accepted while decoding a proof, enough for a 256 bit keyed tree.
+	MaxProofDepth = 256
+	//Max size of a single hash accepted while decoding a proof.
+	MaxProofHashSize = 128
+)
+
+/*
+Returns the exact size in bytes of the binary encoding of a proof for a tree of the given depth.
+Accepts
+  - number of hashes in the proof, which is the depth of the tree for a binary tree
+  - size of each hash in bytes, e.g. 32 for SHA-256
+*/
+func EncodedProofSize(depth int, hashSize int) int {
+	return EncodedKaryProofSize(depth, hashSize, 2)
+}
+
+/*
+Returns the size in bytes of the binary encoding of a proof for a tree with the given branching factor.
+The size is exact for a binary tree, for a k-ary tree it is exact when every level holds branching-1 sibling hashes,
+as in a full tree, and an upper bound otherwise.
+Accepts
+  - number of entries in the proof, which is the depth of the tree
+  - size of each hash in bytes, e.g. 32 for SHA-256
+  - branching factor of the tree
+*/
+func EncodedKaryProofSize(depth int, hashSize int, branching int) int {
+	if branching <= 2 {
+		if depth == 0 {
+			hashSize = 0
+		}
+		return 2 + uvarintSize(uint64(depth)) + uvarintSize(uint64(hashSize)) + (depth+7)/8 + depth*hashSize
+	}
+	entrySize := (branching - 1) * hashSize
+	return 2 + uvarintSize(uint64(depth)) + uvarintSize(uint64(branching)) + depth*(1+uvarintSize(uint64(entrySize))+entrySize)
+}
+
+func uvarintSize(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
+
+/*
+Encodes the proof in a compact binary form.
+Layout is version byte, uvarint hash count, uvarint hash size, hash id byte, indexes packed as a bitfield with
+bit i of byte i/8 set when Indexes[i] is 1, followed by the hashes back to back.
+All hashes in the proof must be of the same size.
+Proofs of k-ary trees, with Branching above 2, are encoded using KaryProofEncodingVersion instead. Layout is version byte,
+uvarint entry count, hash id byte, uvarint branching factor, then for each level the position byte,
+uvarint size of the entry and the concatenated sibling hashes of the entry.
+Proofs without indexes, as accepted for trees built using WithSortedPairs, are encoded with every index set to 0.
+*/
+func (p Proof) MarshalBinary() ([]byte, error) {
+	p = p.withDefaultIndexes()
+	if p.Branching > 2 {
+		return p.marshalKary()
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	depth := len(p.Hashes)
+	hashSize := 0
+	if depth > 0 {
+		hashSize = len(p.Hashes[0])
+	}
+	if depth > 0 && hashSize == 0 {
+		return nil, malformedProof("proof has %d hashes of 0 bytes", depth)
+	}
+	for i, h := range p.Hashes {
+		if len(h) != hashSize {
+			return nil, malformedProof("hash at %d is %d bytes, expected %d", i, len(h), hashSize)
+		}
+	}
+	buf := make([]byte, 0, EncodedProofSize(depth, hashSize))
+	buf = append(buf, ProofEncodingVersion)
+	buf = binary.AppendUvarint(buf, uint64(depth))
+	buf = binary.AppendUvarint(buf, uint64(hashSize))
+	buf = append(buf, byte(p.HashID))
+	bits := make([]byte, (depth+7)/8)
+	for i, index := range p.Indexes {
+		if index == 1 {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	buf = append(buf, bits...)
+	for _, h := range p.Hashes {
+		buf = append(buf, h...)
+	}
+	return buf, nil
+}
+
+func (p Proof) marshalKary() ([]byte, error) {
+	if p.Branching > MaxBranching {
+		return nil, malformedProof("branching factor %d exceeds max supported %d", p.Branching, MaxBranching)
+	}
+	if err := p.validateBranching(p.Branching); err != nil {
+		return nil, err
+	}
+	size := 2 + uvarintSize(uint64(len(p.Hashes))) + uvarintSize(uint64(p.Branching))
+	for i, entry := range p.Hashes {
+		if len(entry) == 0 || len(entry) > MaxProofHashSize*(p.Branching-1) {
+			return nil, malformedProof("entry at %d is %d bytes, expected 1 to %d", i, len(entry), MaxProofHashSize*(p.Branching-1))
+		}
+		size += 1 + uvarintSize(uint64(len(entry))) + len(entry)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, KaryProofEncodingVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(p.Hashes)))
+	buf = append(buf, byte(p.HashID))
+	buf = binary.AppendUvarint(buf, uint64(p.Branching))
+	for i, entry := range p.Hashes {
+		buf = append(buf, byte(p.Indexes[i]))
+		buf = binary.AppendUvarint(buf, uint64(len(entry)))
+		buf = append(buf, entry...)
+	}
+	return buf, nil
+}
+
+/*
+Decodes a proof encoded using MarshalBinary.
+Returns error if the input is truncated, has trailing bytes, uses an unknown version or exceeds MaxProofDepth or MaxProofHashSize.
+*/
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return malformedProof("proof encoding is empty")
+	}
+	version := data[0]
+	if version == KaryProofEncodingVersion {
+		return p.unmarshalKary(data)
+	}
+	if version != 1 && version != ProofEncodingVersion {
+		return malformedProof("unsupported proof encoding version %d", version)
+	}
+	offset := 1
+	depth, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return malformedProof("proof encoding truncated while reading hash count")
+	}
+	offset += n
+	hashSize, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return malformedProof("proof encoding truncated while reading hash size")
+	}
+	offset += n
+	hashID := HashUnknown
+	if version > 1 {
+		if offset == len(data) {
+			return malformedProof("proof encoding truncated while reading hash id")
+		}
+		hashID = HashID(data[offset])
+		offset++
+	}
+	if depth > MaxProofDepth {
+		return malformedProof("proof has %d hashes, max supported is %d", depth, MaxProofDepth)
+	}
+	if hashSize > MaxProofHashSize {
+		return malformedProof("proof hash size %d exceeds max supported %d", hashSize, MaxProofHashSize)
+	}
+	if hashSize == 0 && depth > 0 {
+		return malformedProof("proof has %d hashes of 0 bytes", depth)
+	}
+	expected := offset + (int(depth)+7)/8 + int(depth)*int(hashSize)
+	if len(data) < expected {
+		return malformedProof("proof encoding truncated, expected %d bytes but got %d", expected, len(data))
+	}
+	if len(data) > expected {
+		return malformedProof("proof encoding has %d unexpected trailing bytes", len(data)-expected)
+	}
+	bits := data[offset : offset+(int(depth)+7)/8]
+	offset += len(bits)
+	//Bits past the last index must be 0, so that every proof has a single encoding
+	if depth%8 != 0 && bits[len(bits)-1]>>(depth%8) != 0 {
+		return malformedProof("proof encoding has index bits set past its %d hashes", depth)
+	}
+	p.Hashes = make([][]byte, depth)
+	p.Indexes = make([]int, depth)
+	p.HashID = hashID
+	for i := range p.Hashes {
+		p.Indexes[i] = int(bits[i/8]>>(i%8)) & 1
+		p.Hashes[i] = append([]byte(nil), data[offset:offset+int(hashSize)]...)
+		offset += int(hashSize)
+	}
+	p.Branching = 0
+	return nil
+}
+
+/*
+Decodes a proof of a k-ary tree encoded using KaryProofEncodingVersion.
+*/
+func (p *Proof) unmarshalKary(data []byte) error {
+	offset := 1
+	depth, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return malformedProof("proof encoding truncated while reading entry count")
+	}
+	offset += n
+	if depth > MaxProofDepth {
+		return malformedProof("proof has %d entries, max supported is %d", depth, MaxProofDepth)
+	}
+	if offset == len(data) {
+		return malformedProof("proof encoding truncated while reading hash id")
+	}
+	hashID := HashID(data[offset])
+	offset++
+	branching, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return malformedProof("proof encoding truncated while reading branching factor")
+	}
+	offset += n
+	if branching <= 2 || branching > MaxBranching {
+		return malformedProof("branching factor %d not in [3, %d]", branching, MaxBranching)
+	}
+	proof := Proof{Hashes: make([][]byte, depth), Indexes: make([]int, depth), HashID: hashID, Branching: int(branching)}
+	for i := range proof.Hashes {
+		if offset == len(data) {
+			return malformedProof("proof encoding truncated while reading position at %d", i)
+		}
+		proof.Indexes[i] = int(data[offset])
+		offset++
+		size, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return malformedProof("proof encoding truncated while reading size of entry at %d", i)
+		}
+		offset += n
+		if size == 0 || size > uint64(MaxProofHashSize*(proof.Branching-1)) {
+			return malformedProof("entry at %d is %d bytes, expected 1 to %d", i, size, MaxProofHashSize*(proof.Branching-1))
+		}
+		if uint64(len(data)-offset) < size {
+			return malformedProof("proof encoding truncated while reading entry at %d", i)
+		}
+		proof.Hashes[i] = append([]byte(nil), data[offset:offset+int(size)]...)
+		offset += int(size)
+	}
+	if offset != len(data) {
+		return malformedProof("proof encoding has %d unexpected trailing bytes", len(data)-offset)
+	}
+	if err := proof.validateBranching(proof.Branching); err != nil {
+		return err
+	}
+	*p = proof
+	return nil
+}
+
+type jsonProof struct {
+	Hashes    []string `json:"hashes"`
+	Indexes   []int    `json:"indexes"`
+	Hash      string   `json:"hash,omitempty"`
+	Branching int      `json:"branching,omitempty"`
+}
+
+/*
+Encodes the proof as JSON with hex encoded hashes, e.g. {"hashes":["ab01..."],"indexes":[1],"hash":"sha256"}
+Name of the hash function is left out for proofs with HashUnknown, the branching factor for proofs of binary trees.
+Proofs without indexes are encoded with every index set to 0, like MarshalBinary does.
+*/
+func (p Proof) MarshalJSON() ([]byte, error) {
+	p = p.withDefaultIndexes()
+	if err := p.validateBranching(MaxBranching); err != nil {
+		return nil, err
+	}
+	if p.Branching > MaxBranching {
+		return nil, malformedProof("branching factor %d exceeds max supported %d", p.Branching, MaxBranching)
+	}
+	jp := jsonProof{Hashes: make([]string, len(p.Hashes)), Indexes: p.Indexes, Branching: p.Branching}
+	if jp.Indexes == nil {
+		jp.Indexes = []int{}
+	}
+	for i, h := range p.Hashes {
+		jp.Hashes[i] = hex.EncodeToString(h)
+	}
+	if p.HashID != HashUnknown {
+		jp.Hash = p.HashID.String()
+	}
+	return json.Marshal(jp)
+}
+
+/*
+Decodes a proof encoded using MarshalJSON.
+*/
+func (p *Proof) UnmarshalJSON(data []byte) error {
+	var jp jsonProof
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+	if jp.Branching < 0 || jp.Branching > MaxBranching {
+		return malformedProof("branching factor %d not in [0, %d]", jp.Branching, MaxBranching)
+	}
+	proof := Proof{Hashes: make([][]byte, len(jp.Hashes)), Indexes: jp.Indexes, Branching: jp.Branching}
+	if jp.Hash != "" {
+		id, err := LookupHash(jp.Hash)
+		if err != nil {
+			return malformedProof("%v", err)
+		}
+		proof.HashID = id
+	}
+	for i, h := range jp.Hashes {
+		decoded, err := hex.DecodeString(h)
+		if err != nil {
+			return malformedProof("invalid hash at %d: %v", i, err)
+		}
+		//Entries of k-ary tree proofs hold up to MaxBranching-1 sibling hashes
+		if len(decoded) > MaxProofHashSize*(MaxBranching-1) {
+			return malformedProof("proof hash size %d exceeds max supported %d", len(decoded), MaxProofHashSize*(MaxBranching-1))
+		}
+		proof.Hashes[i] = decoded
+	}
+	branching := MaxBranching
+	if proof.Branching > 2 {
+		branching = proof.Branching
+	}
+	if err := proof.validateBranching(branching); err != nil {
+		return err
+	}
+	*p = proof
+	return nil
+}
+
+/*
+Returns the proof with every index set to 0 if it has hashes but no indexes, as proofs of trees built using WithSortedPairs may.
+*/
+func (p Proof) withDefaultIndexes() Proof {
+	if len(p.Indexes) == 0 && len(p.Hashes) > 0 {
+		p.Indexes = make([]int, len(p.Hashes))
+	}
+	return p
+}
+
+func (p *Proof) validate() error {
+	return p.validateBranching(2)
+}
+
+/*
+Validates the proof for a tree whose nodes have up to branching children.
+*/
+func (p *Proof) validateBranching(branching int) error {
+	if len(p.Hashes) != len(p.Indexes) {
+		return &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("%d hashes but %d indexes", len(p.Hashes), len(p.Indexes))}
+	}
+	if len(p.Hashes) > MaxProofDepth {
+		return &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("proof has %d hashes, max supported is %d", len(p.Hashes), MaxProofDepth)}
+	}
+	for i, index := range p.Indexes {
+		if index < 0 || index >= branching {
+			return &ProofError{Err: ErrMalformedProof, Detail: fmt.Sprintf("invalid index %d at %d", index, i)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package merkletree
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyProofWithRootOnly(t *testing.T) {
+	data := testData(7)
+	for _, opts := range [][]Option{nil, {WithDomainSeparation()}, {WithDomainSeparation(), WithOddNodePromotion()}} {
+		tree, err := NewTree(&data, HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		root := tree.RootHash()
+		for i := range data {
+			proof, err := tree.GenerateMerkleProofByIndex(i)
+			if err != nil {
+				t.Fatalf("Failed to generate Merkle Proof due to error %v", err)
+			}
+			verified, err := VerifyProof(root, data[i], proof, HashFuncSHA256, opts...)
+			if err != nil || !verified {
+				t.Fatalf("Failed to verify Merkle Proof for leaf %d against root due to error %v", i, err)
+			}
+			verified, err = VerifyProof(root, []byte("not in tree"), proof, HashFuncSHA256, opts...)
+			if verified || !errors.Is(err, ErrRootMismatch) {
+				t.Fatalf("Expected ErrRootMismatch for wrong data, got %t, %v", verified, err)
+			}
+		}
+	}
+}
+
+func TestVerifyProofMalformed(t *testing.T) {
+	data := testData(4)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	proof, _ := tree.GenerateMerkleProofByIndex(1)
+
+	proof.Indexes = proof.Indexes[:1]
+	verified, err := VerifyProof(tree.RootHash(), data[1], proof, HashFuncSHA256)
+	var proofErr *ProofError
+	if verified || !errors.As(err, &proofErr) || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for mismatched lengths, got %t, %v", verified, err)
+	}
+	if verified, err := tree.VerifyProof(&data[1], proof); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected tree to reject mismatched lengths, got %t, %v", verified, err)
+	}
+
+	proof, _ = tree.GenerateMerkleProofByIndex(1)
+	proof.Indexes[0] = 2
+	if verified, err := VerifyProof(tree.RootHash(), data[1], proof, HashFuncSHA256); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for invalid index, got %t, %v", verified, err)
+	}
+	if verified, err := VerifyProof(tree.RootHash(), data[1], nil, HashFuncSHA256); verified || !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof for nil proof, got %t, %v", verified, err)
+	}
+}
+
+func TestProofBinaryEncoding(t *testing.T) {
+	for _, count := range []int{1, 2, 7, 64} {
+		data := testData(count)
+		tree, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+		for i := range data {
+			proof, _ := tree.GenerateMerkleProofByIndex(i)
+			encoded, err := proof.MarshalBinary()
+			if err != nil {
+				t.Fatalf("Failed to encode proof due to error %v", err)
+			}
+			if len(encoded) != EncodedProofSize(len(proof.Hashes), 32) {
+				t.Fatalf("Encoded size %d doesn't match estimate %d", len(encoded), EncodedProofSize(len(proof.Hashes), 32))
+			}
+			var decoded Proof
+			if err := decoded.UnmarshalBinary(encoded); err != nil {
+				t.Fatalf("Failed to decode proof due to error %v", err)
+			}
+			if len(decoded.Hashes) != len(proof.Hashes) {
+				t.Fatalf("Decoded proof has %d hashes, expected %d", len(decoded.Hashes), len(proof.Hashes))
+			}
+			if match, err := decoded.Equals(proof); !match {
+				t.Fatalf("Decoded proof doesn't match due to error %v", err)
+			}
+			if verified, err := tree.VerifyProof(&data[i], &decoded); !verified {
+				t.Fatalf("Failed to verify decoded proof due to error %v", err)
+			}
+		}
+	}
+}
+
+func TestProofBinaryEncodingInvalid(t *testing.T) {
+	data := testData(8)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	proof, _ := tree.GenerateMerkleProofByIndex(5)
+	encoded, _ := proof.MarshalBinary()
+
+	var decoded Proof
+	for _, n := range []int{0, 1, 2, 3, 4, len(encoded) - 1} {
+		if err := decoded.UnmarshalBinary(encoded[:n]); err == nil {
+			t.Fatalf("Expected error decoding proof truncated to %d bytes", n)
+		}
+	}
+	if err := decoded.UnmarshalBinary(append(encoded, 0)); err == nil {
+		t.Fatalf("Expected error decoding proof with trailing bytes")
+	}
+	badVersion := append([]byte{}, encoded...)
+	badVersion[0] = KaryProofEncodingVersion + 1
+	if err := decoded.UnmarshalBinary(badVersion); err == nil {
+		t.Fatalf("Expected error decoding proof with unknown version")
+	}
+	oversized := []byte{ProofEncodingVersion, 0xff, 0xff, 0x03, 32}
+	if err := decoded.UnmarshalBinary(oversized); err == nil {
+		t.Fatalf("Expected error decoding proof with too many hashes")
+	}
+	padded := append([]byte(nil), encoded...)
+	padded[4] |= 0x80
+	if err := decoded.UnmarshalBinary(padded); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof decoding proof with index bits set past its hashes, got %v", err)
+	}
+	if err := decoded.UnmarshalBinary([]byte{ProofEncodingVersion, 2, 0, byte(HashUnknown), 0}); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof decoding hashes of 0 bytes, got %v", err)
+	}
+	if _, err := (Proof{Hashes: [][]byte{{}, {}}, Indexes: []int{0, 1}}).MarshalBinary(); !errors.Is(err, ErrMalformedProof) {
+		t.Fatalf("Expected ErrMalformedProof encoding hashes of 0 bytes, got %v", err)
+	}
+
+	proof.Hashes[1] = proof.Hashes[1][:16]
+	if _, err := proof.MarshalBinary(); err == nil {
+		t.Fatalf("Expected error encoding proof with hashes of different sizes")
+	}
+}
+
+func TestProofEncodingWithoutIndexes(t *testing.T) {
+	opts := []Option{WithSortedPairs(), WithDomainSeparation()}
+	data := testData(11)
+	tree, _ := NewTree(&data, HashFuncSHA256, opts...)
+	for i := range data {
+		full, _ := tree.GenerateMerkleProofByIndex(i)
+		proof := Proof{Hashes: full.Hashes, HashID: full.HashID}
+		encoded, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to encode proof without indexes due to error %v", err)
+		}
+		if len(encoded) != EncodedProofSize(len(proof.Hashes), 32) {
+			t.Fatalf("Encoded size %d doesn't match estimate %d", len(encoded), EncodedProofSize(len(proof.Hashes), 32))
+		}
+		var decoded Proof
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("Failed to decode proof due to error %v", err)
+		}
+		if verified, err := VerifyProof(tree.RootHash(), data[i], &decoded, HashFuncSHA256, opts...); !verified {
+			t.Fatalf("Failed to verify decoded proof of leaf %d due to error %v", i, err)
+		}
+
+		encoded, err = json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Failed to encode proof without indexes as JSON due to error %v", err)
+		}
+		decoded = Proof{}
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("Failed to decode JSON proof due to error %v", err)
+		}
+		if verified, err := VerifyProof(tree.RootHash(), data[i], &decoded, HashFuncSHA256, opts...); !verified {
+			t.Fatalf("Failed to verify JSON decoded proof of leaf %d due to error %v", i, err)
+		}
+	}
+}
+
+func TestProofJSONEncoding(t *testing.T) {
+	data := testData(6)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	proof, _ := tree.GenerateMerkleProofByIndex(3)
+	encoded, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Failed to encode proof due to error %v", err)
+	}
+	if !strings.Contains(string(encoded), hex.EncodeToString(proof.Hashes[0])) {
+		t.Fatalf("Expected hex encoded hashes in %s", encoded)
+	}
+	var decoded Proof
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode proof due to error %v", err)
+	}
+	if verified, err := tree.VerifyProof(&data[3], &decoded); !verified {
+		t.Fatalf("Failed to verify decoded proof due to error %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"hashes":["zz"],"indexes":[0]}`,
+		`{"hashes":["00"],"indexes":[]}`,
+		`{"hashes":["00"],"indexes":[-1]}`,
+		`{"hashes":["00"],"indexes":[256]}`,
+	} {
+		if err := json.Unmarshal([]byte(invalid), &decoded); err == nil {
+			t.Fatalf("Expected error decoding %s", invalid)
+		}
+	}
+}
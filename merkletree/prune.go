@@ -0,0 +1,234 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+Forgets the data of the first count leaves, keeping only what is needed to append leaves and prove the others.
+Every subtree whose leaves are all pruned is collapsed into a single node holding its hash, dropping the nodes below it.
+Leaves of a collapsed subtree can only be proven using GeneratePrunedProof, passing their data back.
+Pruned leaves can't be updated or removed, leaves after them can, and leaves can be appended as before.
+Pruning fewer leaves than earlier calls did is a no-op. Levels only keep an empty slot for each dropped node.
+Nodes surviving a prune are moved out of the allocations they share with dropped ones once as many nodes are dropped
+as leaves remain unpruned, so memory held by dropped nodes stays proportional to the unpruned part of the tree.
+Accepts
+  - number of leading leaves to prune, at most the leaf count
+
+Returns
+  - error in case count is out of range or the tree doesn't keep its nodes in memory or is built using WithSortedLeaves
+*/
+func (t *MerkleTree) Prune(count int) error {
+	if count < 0 || count > t.LeafCount() {
+		return fmt.Errorf("%w: prune count %d not in [0, %d]", ErrIndexOutOfRange, count, t.LeafCount())
+	}
+	if t.config.store != nil {
+		return fmt.Errorf("%w: trees kept in a node store don't hold leaf data to prune", ErrUnsupported)
+	}
+	if t.config.sortedLeaves {
+		return fmt.Errorf("%w: leaves of a tree built using WithSortedLeaves move, so they can't be pruned", ErrUnsupported)
+	}
+	if count <= t.pruned {
+		return nil
+	}
+	if err := t.ensureLevels(); err != nil {
+		return err
+	}
+	for i := t.pruned; i < count; i++ {
+		if leaf := t.Leaves[i]; leaf != nil {
+			leaf.Data = nil
+			leaf.IsPruned = true
+		}
+	}
+	if last := len(t.Leaves) - 1; t.Leaves[last].IsDuplicate && last == count {
+		t.Leaves[last].Data = nil
+	}
+	//Bottom up, so that the children of a node being collapsed have already dropped their own subtrees.
+	k := t.config.arity()
+	for level, size := 1, k; level < len(t.levels); level, size = level+1, size*k {
+		for i := t.pruned / size; i < count/size; i++ {
+			t.collapse(level, i)
+		}
+	}
+	t.pruned = count
+	if t.dropped > 0 && t.dropped >= t.LeafCount()-count {
+		t.relocateNodes()
+	}
+	return nil
+}
+
+/*
+Drops the children of the node at level and index, whose leaves are all pruned.
+*/
+func (t *MerkleTree) collapse(level int, index int) {
+	node := t.levels[level][index]
+	if node == nil || node.IsPruned {
+		return
+	}
+	k := t.config.arity()
+	for i := index * k; i < (index+1)*k; i++ {
+		if child := t.levels[level-1][i]; child.IsLeaf {
+			t.leafIndex.remove(child.Hash, i)
+		}
+		t.levels[level-1][i] = nil
+		t.dropped++
+	}
+	//The hash may be part of a slab shared with the dropped nodes
+	node.Hash = append([]byte(nil), node.Hash...)
+	node.Left = nil
+	node.Right = nil
+	node.Children = nil
+	node.IsPruned = true
+}
+
+/*
+Moves every node left in the levels into new allocations made for each level, releasing the slabs of nodes,
+child lists and hashes they shared with nodes dropped by collapse.
+*/
+func (t *MerkleTree) relocateNodes() {
+	moved := make(map[*Node]*Node)
+	for _, level := range t.levels {
+		//A node promoted from the level below is already moved
+		var nodes []*Node
+		hashSize, childCount := 0, 0
+		for _, node := range level {
+			if node != nil && moved[node] == nil {
+				moved[node] = node
+				nodes = append(nodes, node)
+				hashSize += len(node.Hash)
+				childCount += len(node.Children)
+			}
+		}
+		copies := make([]Node, len(nodes))
+		hashes := make([]byte, 0, hashSize)
+		children := make([]*Node, 0, childCount)
+		for i, node := range nodes {
+			copies[i] = *node
+			copies[i].Hash = hashes[len(hashes) : len(hashes)+len(node.Hash) : len(hashes)+len(node.Hash)]
+			hashes = append(hashes, node.Hash...)
+			if node.Children != nil {
+				copies[i].Children = children[len(children) : len(children)+len(node.Children) : len(children)+len(node.Children)]
+				children = append(children, node.Children...)
+			}
+			moved[node] = &copies[i]
+		}
+	}
+
+	relink := func(node *Node) *Node {
+		if node == nil {
+			return nil
+		}
+		return moved[node]
+	}
+	for _, node := range moved {
+		node.Parent = relink(node.Parent)
+		node.Left = relink(node.Left)
+		node.Right = relink(node.Right)
+		for i := range node.Children {
+			node.Children[i] = relink(node.Children[i])
+		}
+	}
+	for _, level := range t.levels {
+		for i := range level {
+			level[i] = relink(level[i])
+		}
+	}
+	for i := range t.Leaves {
+		if node, ok := moved[t.Leaves[i]]; ok {
+			t.Leaves[i] = node
+		}
+	}
+	t.Root = relink(t.Root)
+	t.dropped = 0
+}
+
+/*
+Returns the number of leading leaves pruned using Prune.
+*/
+func (t *MerkleTree) PrunedCount() int {
+	return t.pruned
+}
+
+/*
+Returns the range of leaves of the collapsed subtree holding the leaf at index, whose data GeneratePrunedProof needs.
+A leaf that isn't part of a collapsed subtree is a range of its own.
+Accepts
+  - position of the leaf, starting at 0
+
+Returns
+  - first leaf of the range and the position after its last one
+  - error in case index is out of range
+*/
+func (t *MerkleTree) PrunedRange(index int) (int, int, error) {
+	if index < 0 || index >= t.LeafCount() {
+		return 0, 0, fmt.Errorf("%w: leaf index %d not in [0, %d)", ErrIndexOutOfRange, index, t.LeafCount())
+	}
+	if t.config.store != nil {
+		return index, index + 1, nil
+	}
+	if err := t.ensureLevels(); err != nil {
+		return 0, 0, err
+	}
+	k := t.config.arity()
+	//Nodes below a collapsed node are nil, the first one found going up is the collapsed node itself.
+	size := 1
+	for level := 0; t.levels[level][index/size] == nil; level++ {
+		size *= k
+	}
+	start := index / size * size
+	return start, start + size, nil
+}
+
+/*
+Generates a proof for a leaf of a collapsed subtree using the data of all leaves of that subtree, as returned by PrunedRange.
+The subtree is rebuilt from data and checked against the hash kept for it, it is not restored in the tree.
+For a leaf that isn't part of a collapsed subtree, data holds just that leaf.
+Accepts
+  - position of the leaf, starting at 0
+  - data of the leaves in the range returned by PrunedRange for index
+
+Returns
+  - Reference to a Proof object
+  - error wrapping ErrRootMismatch if data doesn't match the pruned subtree, or error in case index is out of range
+*/
+func (t *MerkleTree) GeneratePrunedProof(index int, data Data) (*Proof, error) {
+	start, end, err := t.PrunedRange(index)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != end-start {
+		return nil, fmt.Errorf("%w: expected data of the %d leaves in [%d, %d), got %d", ErrIndexOutOfRange, end-start, start, end, len(data))
+	}
+	if end-start == 1 {
+		hash, err := t.hashLeaf(data[0])
+		if err != nil {
+			return nil, err
+		}
+		leafHash, err := t.nodeHash(0, index)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(hash, leafHash) {
+			return nil, fmt.Errorf("%w: data doesn't match leaf %d", ErrRootMismatch, index)
+		}
+		return t.GenerateMerkleProofByIndex(index)
+	}
+
+	//Collapsed subtrees are complete, so the subtree built alone has the same shape and root.
+	subtree, err := newTree(&data, t.HashFunc, t.config)
+	if err != nil {
+		return nil, err
+	}
+	node := t.levels[subtree.Depth][start/(end-start)]
+	if !bytes.Equal(subtree.RootHash(), node.Hash) {
+		return nil, fmt.Errorf("%w: data doesn't match pruned leaves [%d, %d)", ErrRootMismatch, start, end)
+	}
+	proof, err := subtree.GenerateMerkleProofByIndex(index - start)
+	if err != nil {
+		return nil, err
+	}
+	t.appendPath(proof, node)
+	proof.HashID = t.HashID
+	return proof, nil
+}
@@ -0,0 +1,222 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// Checks that a pruned tree has the root of a tree built from all data and that every leaf can still be proven.
+func assertPrunedMatches(t *testing.T, tree *MerkleTree, data Data, opts ...Option) {
+	t.Helper()
+	expected := assertRootMatchesRebuilt(t, tree, data, opts...)
+	for i := range data {
+		start, end, err := tree.PrunedRange(i)
+		if err != nil || start > i || end <= i {
+			t.Fatalf("Invalid pruned range [%d, %d) for leaf %d, error %v", start, end, i, err)
+		}
+		var proof *Proof
+		if end-start == 1 {
+			proof, err = tree.GenerateMerkleProofByIndex(i)
+		} else {
+			proof, err = tree.GeneratePrunedProof(i, data[start:end])
+		}
+		if err != nil {
+			t.Fatalf("Failed to generate proof for leaf %d in [%d, %d) due to error %v", i, start, end, err)
+		}
+		if verified, err := expected.VerifyProof(&data[i], proof); !verified {
+			t.Fatalf("Failed to verify proof for leaf %d of %d due to error %v", i, len(data), err)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithOddNodePromotion(), WithDomainSeparation()},
+		{WithBranching(3)},
+		{WithBranching(4), WithOddNodePromotion()},
+	} {
+		for _, count := range []int{1, 2, 7, 8, 13} {
+			for prune := 0; prune <= count; prune++ {
+				data := testData(count)
+				tree, _ := NewTree(&data, HashFuncSHA256, opts...)
+				if err := tree.Prune(prune); err != nil {
+					t.Fatalf("Failed to prune %d of %d leaves due to error %v", prune, count, err)
+				}
+				if tree.PrunedCount() != prune {
+					t.Fatalf("Expected %d pruned leaves, got %d", prune, tree.PrunedCount())
+				}
+				for i := 0; i < prune; i++ {
+					if leaf := tree.Leaves[i]; leaf != nil && (leaf.Data != nil || !leaf.IsPruned) {
+						t.Fatalf("Leaf %d still holds data after pruning %d leaves", i, prune)
+					}
+				}
+				assertPrunedMatches(t, tree, data, opts...)
+
+				for i := 0; i < 5; i++ {
+					data = append(data, []byte{byte(i)})
+					if err := tree.AppendLeaf(data[len(data)-1]); err != nil {
+						t.Fatalf("Failed to append leaf after pruning due to error %v", err)
+					}
+				}
+				assertPrunedMatches(t, tree, data, opts...)
+			}
+		}
+	}
+}
+
+func TestPruneCollapsesSubtrees(t *testing.T) {
+	data := testData(16)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	if err := tree.Prune(10); err != nil {
+		t.Fatalf("Failed to prune due to error %v", err)
+	}
+	//Leaves 0-7 are under a single collapsed node, 8 and 9 under another one
+	if start, end, _ := tree.PrunedRange(5); start != 0 || end != 8 {
+		t.Fatalf("Expected leaf 5 in pruned range [0, 8), got [%d, %d)", start, end)
+	}
+	if start, end, _ := tree.PrunedRange(9); start != 8 || end != 10 {
+		t.Fatalf("Expected leaf 9 in pruned range [8, 10), got [%d, %d)", start, end)
+	}
+	if start, end, _ := tree.PrunedRange(10); start != 10 || end != 11 {
+		t.Fatalf("Expected leaf 10 to be a range of its own, got [%d, %d)", start, end)
+	}
+	if node := tree.levels[3][0]; !node.IsPruned || node.Left != nil || node.Right != nil {
+		t.Fatalf("Expected node covering leaves 0-7 to be collapsed")
+	}
+	for level, nodes := range tree.levels[:3] {
+		for i := 0; i < 8>>level; i++ {
+			if nodes[i] != nil {
+				t.Fatalf("Node %d at level %d is kept below a collapsed node", i, level)
+			}
+		}
+	}
+
+	if _, err := tree.GenerateMerkleProofByIndex(3); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned for proof of collapsed leaf, got %v", err)
+	}
+	wrong := append(Data{[]byte("forged")}, data[1:8]...)
+	if _, err := tree.GeneratePrunedProof(3, wrong); !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected ErrRootMismatch for forged data, got %v", err)
+	}
+	if _, err := tree.GeneratePrunedProof(3, data[:4]); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange for data of part of the pruned range, got %v", err)
+	}
+	if _, err := tree.GenerateMerkleProof(&data[3]); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected collapsed leaf to no longer be found, got %v", err)
+	}
+	if _, err := tree.GetNodes(0, []int{3}); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned reading collapsed leaf hash, got %v", err)
+	}
+}
+
+func TestPruneModifications(t *testing.T) {
+	data := testData(12)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	tree.Prune(5)
+	if err := tree.UpdateLeafAt(4, []byte("x")); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned updating pruned leaf, got %v", err)
+	}
+	if err := tree.UpdateLeafAt(1, []byte("x")); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned updating collapsed leaf, got %v", err)
+	}
+	if err := tree.RemoveLeafAt(2); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned removing collapsed leaf, got %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); !errors.Is(err, ErrPruned) {
+		t.Fatalf("Expected ErrPruned writing snapshot of pruned tree, got %v", err)
+	}
+
+	data[7] = []byte("updated")
+	if err := tree.UpdateLeafAt(7, data[7]); err != nil {
+		t.Fatalf("Failed to update leaf after pruned ones due to error %v", err)
+	}
+	data = append(data[:9], data[10:]...)
+	if err := tree.RemoveLeafAt(9); err != nil {
+		t.Fatalf("Failed to remove leaf after pruned ones due to error %v", err)
+	}
+	assertPrunedMatches(t, tree, data)
+
+	if err := tree.Prune(len(data) + 1); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("Expected ErrIndexOutOfRange pruning more leaves than present, got %v", err)
+	}
+	if err := tree.Prune(2); err != nil || tree.PrunedCount() != 5 {
+		t.Fatalf("Expected pruning fewer leaves to be a no-op, got %d pruned, error %v", tree.PrunedCount(), err)
+	}
+	stored, _ := NewTree(&data, HashFuncSHA256, WithNodeStore(NewMemoryNodeStore()))
+	if err := stored.Prune(2); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported pruning a tree kept in a node store, got %v", err)
+	}
+	sorted, _ := NewTree(&data, HashFuncSHA256, WithSortedLeaves())
+	if err := sorted.Prune(2); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported pruning a tree with sorted leaves, got %v", err)
+	}
+}
+
+func TestPruneRollingWindow(t *testing.T) {
+	const window = 8
+	data := testData(1)
+	tree, _ := NewTree(&data, HashFuncSHA256, WithOddNodePromotion())
+	for i := 1; i < 1000; i++ {
+		data = append(data, []byte{byte(i), byte(i >> 8)})
+		if err := tree.AppendLeaf(data[i]); err != nil {
+			t.Fatalf("Failed to append leaf %d due to error %v", i, err)
+		}
+		if len(data) > window {
+			if err := tree.Prune(len(data) - window); err != nil {
+				t.Fatalf("Failed to prune due to error %v", err)
+			}
+		}
+	}
+	//Only nodes on the right edge and recent leaves remain, O(window + log n) of them
+	kept := 0
+	for _, nodes := range tree.levels {
+		for _, node := range nodes {
+			if node != nil {
+				kept++
+			}
+		}
+	}
+	if kept > 4*window+2*tree.Depth {
+		t.Fatalf("Expected O(window + depth) nodes to be kept, got %d", kept)
+	}
+	assertPrunedMatches(t, tree, data, WithOddNodePromotion())
+}
+
+func TestPruneReleasesSharedAllocations(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithBranching(4)}} {
+		data := testData(1024)
+		tree, err := NewTreeWithHasher(&data, sha256.New, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		//Nodes and hashes built by NewTree, which share slabs of each level
+		built := make(map[*Node]bool)
+		hashes := make(map[*byte]bool)
+		for _, nodes := range tree.levels {
+			for _, node := range nodes {
+				built[node] = true
+				hashes[&node.Hash[0]] = true
+			}
+		}
+		if err := tree.Prune(1000); err != nil {
+			t.Fatalf("Failed to prune due to error %v", err)
+		}
+		for level, nodes := range tree.levels {
+			for i, node := range nodes {
+				if node != nil && (built[node] || hashes[&node.Hash[0]]) {
+					t.Fatalf("Node %d at level %d still shares the allocations of pruned nodes", i, level)
+				}
+			}
+		}
+		assertPrunedMatches(t, tree, data, opts...)
+		data = append(data, []byte("appended"))
+		if err := tree.AppendLeaf(data[len(data)-1]); err != nil {
+			t.Fatalf("Failed to append leaf after pruning due to error %v", err)
+		}
+		assertPrunedMatches(t, tree, data, opts...)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build race
+
+package merkletree
+
+// The race detector makes sync.Pool drop digests at random, so allocation counts don't hold
+const raceEnabled = true
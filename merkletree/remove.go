@@ -0,0 +1,101 @@
+package merkletree
+
+import "fmt"
+
+/*
+Removes the leaf holding data from the tree, shifting the leaves after it one position left.
+If data is present more than once, the first matching leaf is removed.
+Accepts
+  - data of the leaf to be removed
+
+Returns
+  - error in case any error occurs or data not found
+*/
+func (t *MerkleTree) RemoveLeaf(data []byte) error {
+	hash, err := t.hashLeaf(data)
+	if err != nil {
+		return err
+	}
+	index, found := t.lookupLeaf(hash)
+	if !found {
+		return ErrLeafNotFound
+	}
+	return t.RemoveLeafAt(index)
+}
+
+/*
+Removes the leaf at position index from the tree, shifting the leaves after it one position left.
+Only nodes covering positions from index onwards are rebuilt, nodes to the left of it are left untouched.
+Accepts
+  - position of the leaf, starting at 0
+
+Returns
+  - error in case index is out of range or it is the only leaf in the tree
+*/
+func (t *MerkleTree) RemoveLeafAt(index int) error {
+	count := t.LeafCount()
+	if index < 0 || index >= count {
+		return fmt.Errorf("%w: leaf index %d not in [0, %d)", ErrIndexOutOfRange, index, count)
+	}
+	if count == 1 {
+		return fmt.Errorf("%w: cannot remove the only leaf of a merkle tree", ErrEmptyData)
+	}
+	if index < t.pruned {
+		return fmt.Errorf("%w: cannot remove leaf %d", ErrPruned, index)
+	}
+	if t.config.store != nil {
+		return t.storeRemoveLeaf(index)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return err
+	}
+	removed := t.Leaves[index]
+	removed.Parent = nil
+	t.leafIndex.remove(removed.Hash, index)
+	for i := index + 1; i < count; i++ {
+		t.leafIndex.remove(t.Leaves[i].Hash, i)
+		t.leafIndex.add(t.Leaves[i].Hash, i-1)
+	}
+
+	leaves := make([]*Node, 0, count+1)
+	leaves = append(leaves, t.Leaves[:index]...)
+	leaves = append(leaves, t.Leaves[index+1:count]...)
+	if t.config.needsPadLeaf(len(leaves)) {
+		// Handle case of odd leaves. Create a duplicate leaf node
+		last := leaves[len(leaves)-1]
+		pad, err := buildLeafNode(last.Data, last.Hash, t)
+		if err != nil {
+			return err
+		}
+		pad.IsDuplicate = true
+		leaves = append(leaves, pad)
+	}
+	t.Leaves = leaves
+	return t.rebuildFrom(index)
+}
+
+/*
+Rebuilds nodes of all levels covering leaf positions from index onwards, reusing nodes to the left of it.
+*/
+func (t *MerkleTree) rebuildFrom(index int) error {
+	k := t.config.arity()
+	levels := [][]*Node{t.Leaves}
+	for level := 0; len(levels[level]) > 1; level, index = level+1, index/k {
+		//Start from the first node of the group containing index at this level
+		start := index - index%k
+		parents, err := buildParentLevel(levels[level][start:], t)
+		if err != nil {
+			return err
+		}
+		var kept []*Node
+		if level+1 < len(t.levels) {
+			kept = t.levels[level+1][:start/k]
+		}
+		levels = append(levels, append(kept[:len(kept):len(kept)], parents...))
+	}
+	t.levels = levels
+	t.Root = levels[len(levels)-1][0]
+	t.Root.Parent = nil
+	t.Depth = len(levels) - 1
+	return nil
+}
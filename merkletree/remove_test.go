@@ -0,0 +1,79 @@
+package merkletree
+
+import (
+	"testing"
+)
+
+func TestRemoveLeafAt(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}} {
+		//Odd and even leaf counts, removing from the front, the middle and the end
+		for _, count := range []int{2, 3, 8, 9, 17} {
+			for _, position := range []string{"first", "middle", "last"} {
+				data := testData(count)
+				tree, err := NewTree(&data, HashFuncSHA256, opts...)
+				if err != nil {
+					t.Fatalf("Failed to build Tree due to error %v", err)
+				}
+				for len(data) > 1 {
+					index := 0
+					switch position {
+					case "middle":
+						index = len(data) / 2
+					case "last":
+						index = len(data) - 1
+					}
+					if err := tree.RemoveLeafAt(index); err != nil {
+						t.Fatalf("Failed to remove leaf %d due to error %v", index, err)
+					}
+					data = append(data[:index:index], data[index+1:]...)
+					assertMatchesRebuilt(t, tree, data, opts...)
+				}
+				if err := tree.RemoveLeafAt(0); err == nil {
+					t.Fatalf("Expected error removing the only leaf")
+				}
+			}
+		}
+	}
+}
+
+func TestRemoveLeaf(t *testing.T) {
+	data := testData(6)
+	tree, _ := NewTree(&data, HashFuncSHA256)
+	if err := tree.RemoveLeaf(data[2]); err != nil {
+		t.Fatalf("Failed to remove leaf due to error %v", err)
+	}
+	removed := data[2]
+	data = append(data[:2:2], data[3:]...)
+	assertMatchesRebuilt(t, tree, data)
+	if !tree.Leaves[len(tree.Leaves)-1].IsDuplicate {
+		t.Fatalf("Expected duplicate padding leaf after removing down to an odd leaf count")
+	}
+	if _, err := tree.GenerateMerkleProof(&removed); err == nil {
+		t.Fatalf("Expected removed leaf to no longer be found")
+	}
+	if err := tree.RemoveLeaf(removed); err == nil {
+		t.Fatalf("Expected error removing a leaf not in the tree")
+	}
+	for i := range data {
+		proof, err := tree.GenerateMerkleProof(&data[i])
+		if err != nil {
+			t.Fatalf("Failed to find shifted leaf %d due to error %v", i, err)
+		}
+		byIndex, _ := tree.GenerateMerkleProofByIndex(i)
+		if match, err := proof.Equals(byIndex); !match {
+			t.Fatalf("Leaf %d isn't indexed at its shifted position due to error %v", i, err)
+		}
+	}
+	if err := tree.RemoveLeaf(data[4]); err != nil {
+		t.Fatalf("Failed to remove leaf due to error %v", err)
+	}
+	data = data[:4]
+	assertMatchesRebuilt(t, tree, data)
+	if tree.Leaves[len(tree.Leaves)-1].IsDuplicate {
+		t.Fatalf("Expected duplicate padding leaf to be dropped for an even leaf count")
+	}
+	if err := tree.AppendLeaf([]byte("appended")); err != nil {
+		t.Fatalf("Failed to append after removal due to error %v", err)
+	}
+	assertMatchesRebuilt(t, tree, append(data, []byte("appended")))
+}
@@ -0,0 +1,433 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	//Version of the snapshot format written by WriteTo.
+	SnapshotVersion byte = 1
+	//Leaf hashes are read in batches of this many bytes, so that a corrupted leaf count can't trigger a huge allocation.
+	snapshotReadBatch = 1 << 20
+)
+
+var snapshotMagic = [4]byte{'M', 'K', 'T', 'S'}
+
+/*
+Selects the optional sections written by WriteSnapshot. Leaf hashes are always written.
+*/
+type SnapshotContent uint8
+
+const (
+	//Writes hashes of all levels between the leaves and the root, so loading doesn't need to hash anything.
+	SnapshotLevels SnapshotContent = 1 << iota
+	//Writes data of every leaf, so that loaded leaves have Data set.
+	SnapshotLeafData
+)
+
+// Bits of the flags byte in the snapshot header
+const (
+	snapshotDomainSeparation byte = 1 << iota
+	snapshotPromoteOddNodes
+	snapshotSortedLeaves
+	snapshotSortedPairs
+	snapshotHasLevels
+	snapshotHasLeafData
+)
+
+/*
+Writes a snapshot of the tree holding leaf hashes and leaf data, implementing io.WriterTo.
+Use WriteSnapshot to also write interior levels or leave out leaf data.
+*/
+func (t *MerkleTree) WriteTo(w io.Writer) (int64, error) {
+	return t.WriteSnapshot(w, SnapshotLeafData)
+}
+
+/*
+Writes a snapshot of the tree that can be loaded using ReadTree.
+Layout is magic "MKTS", version byte, flags byte recording tree options and sections present, hash id byte,
+uvarint hash size, uvarint leaf count, root hash, leaf hashes, then optionally hashes of levels 1 to Depth-1 and
+uvarint length prefixed leaf data, followed by a CRC-32C of everything before it.
+Leaf data is not written for trees built using WithNodeStore, as they don't keep it.
+Accepts
+  - writer for the snapshot
+  - optional sections to write
+
+Returns
+  - number of bytes written
+  - error in case writing fails or the node store fails
+*/
+func (t *MerkleTree) WriteSnapshot(w io.Writer, content SnapshotContent) (int64, error) {
+	if err := t.requireBinary("snapshots"); err != nil {
+		return 0, err
+	}
+	if t.pruned > 0 {
+		return 0, fmt.Errorf("%w: snapshots need all leaves of the tree", ErrPruned)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return 0, err
+	}
+	sw := snapshotWriter{w: bufio.NewWriter(w), crc: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+	flags := t.config.snapshotFlags()
+	if content&SnapshotLevels != 0 {
+		flags |= snapshotHasLevels
+	}
+	if content&SnapshotLeafData != 0 && t.config.store == nil {
+		flags |= snapshotHasLeafData
+	}
+	count := t.LeafCount()
+	header := append(snapshotMagic[:0:0], snapshotMagic[:]...)
+	header = append(header, SnapshotVersion, flags, byte(t.HashID))
+	header = binary.AppendUvarint(header, uint64(len(t.RootHash())))
+	header = binary.AppendUvarint(header, uint64(count))
+	header = append(header, t.RootHash()...)
+	sw.write(header)
+
+	for i := 0; i < count; i++ {
+		hash, err := t.nodeHash(0, i)
+		if err != nil {
+			return sw.n, err
+		}
+		sw.write(hash)
+	}
+	if flags&snapshotHasLevels != 0 {
+		size := count
+		for level := 1; level < t.Depth; level++ {
+			size = (size + 1) / 2
+			for i := 0; i < size; i++ {
+				hash, err := t.nodeHash(level, i)
+				if err != nil {
+					return sw.n, err
+				}
+				sw.write(hash)
+			}
+		}
+	}
+	if flags&snapshotHasLeafData != 0 {
+		for _, leaf := range t.Leaves[:count] {
+			sw.write(binary.AppendUvarint(nil, uint64(len(leaf.Data))))
+			sw.write(leaf.Data)
+		}
+	}
+	sw.write(sw.crc.Sum(nil))
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	return sw.n, sw.err
+}
+
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	n   int64
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc.Write(p)
+	var n int
+	n, sw.err = sw.w.Write(p)
+	sw.n += int64(n)
+}
+
+func (c *treeConfig) snapshotFlags() byte {
+	var flags byte
+	if c.domainSeparation {
+		flags |= snapshotDomainSeparation
+	}
+	if c.promoteOddNodes {
+		flags |= snapshotPromoteOddNodes
+	}
+	if c.sortedLeaves {
+		flags |= snapshotSortedLeaves
+	}
+	if c.sortedPairs {
+		flags |= snapshotSortedPairs
+	}
+	return flags
+}
+
+/*
+Loads a tree from a snapshot written using WriteTo or WriteSnapshot, hashing with the registered hash function it records.
+Tree options are restored from the snapshot, only options such as WithWorkers or WithLazyLevels need to be passed.
+Interior levels are taken from the snapshot when present, otherwise they are rebuilt from the leaf hashes.
+Either way the root is checked against the stored one.
+Only the bytes of the snapshot are read from r.
+Accepts
+  - reader positioned at the start of the snapshot
+  - Optional settings
+
+Returns
+  - Reference to the tree in case of no errors
+  - error wrapping ErrCorruptedSnapshot if the snapshot fails its checksum or root check, or other error while reading
+*/
+func ReadTree(r io.Reader, opts ...Option) (*MerkleTree, error) {
+	return readTree(r, nil, opts)
+}
+
+/*
+Same as ReadTree for snapshots of trees built with a HashFunction that is not registered.
+*/
+func ReadTreeWithHashFunc(r io.Reader, hashFunc HashFunction, opts ...Option) (*MerkleTree, error) {
+	return readTree(r, hashFunc, opts)
+}
+
+func readTree(r io.Reader, hashFunc HashFunction, opts []Option) (*MerkleTree, error) {
+	sr := snapshotReader{r: r, crc: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+	header := make([]byte, len(snapshotMagic)+3)
+	if err := sr.readFull(header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic[:]) {
+		return nil, fmt.Errorf("%w: not a tree snapshot", ErrCorruptedSnapshot)
+	}
+	version, flags, hashID := header[4], header[5], HashID(header[6])
+	if version != SnapshotVersion {
+		return nil, fmt.Errorf("%w: snapshot version %d", ErrUnsupported, version)
+	}
+	hashSize, err := binary.ReadUvarint(&sr)
+	if err != nil {
+		return nil, sr.corrupted(err)
+	}
+	count, err := binary.ReadUvarint(&sr)
+	if err != nil {
+		return nil, sr.corrupted(err)
+	}
+	if hashSize == 0 || hashSize > MaxProofHashSize || count == 0 || count > uint64(maxInt) {
+		return nil, fmt.Errorf("%w: invalid hash size %d or leaf count %d", ErrCorruptedSnapshot, hashSize, count)
+	}
+
+	config := newTreeConfig(opts)
+	config.domainSeparation = flags&snapshotDomainSeparation != 0
+	config.promoteOddNodes = flags&snapshotPromoteOddNodes != 0
+	config.sortedLeaves = flags&snapshotSortedLeaves != 0
+	config.sortedPairs = flags&snapshotSortedPairs != 0
+	config.store = nil
+	//Only binary trees are written to snapshots
+	config.branching = 0
+	if hashFunc == nil {
+		newHash, err := hashID.New()
+		if err != nil {
+			return nil, err
+		}
+		config.digests = newDigestPool(newHash)
+		digests := config.digests
+		hashFunc = func(data []byte) ([]byte, error) {
+			return digests.sum(nil, nil, data, nil), nil
+		}
+	}
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	tree := MerkleTree{HashFunc: hashFunc, HashID: hashID, config: config}
+	tree.Depth = config.depth(int(count))
+
+	root := make([]byte, hashSize)
+	if err := sr.readFull(root); err != nil {
+		return nil, err
+	}
+	leafHashes, err := sr.readHashes(int(count), int(hashSize))
+	if err != nil {
+		return nil, err
+	}
+	var levelHashes [][][]byte
+	if flags&snapshotHasLevels != 0 {
+		size := int(count)
+		for level := 1; level < tree.Depth; level++ {
+			size = (size + 1) / 2
+			hashes, err := sr.readHashes(size, int(hashSize))
+			if err != nil {
+				return nil, err
+			}
+			levelHashes = append(levelHashes, hashes)
+		}
+	}
+	nodes := make([]Node, count)
+	tree.Leaves = make([]*Node, count, count+1)
+	for i := range nodes {
+		nodes[i] = Node{Hash: leafHashes[i], IsLeaf: true}
+		tree.Leaves[i] = &nodes[i]
+	}
+	if flags&snapshotHasLeafData != 0 {
+		for _, leaf := range tree.Leaves {
+			length, err := binary.ReadUvarint(&sr)
+			if err != nil {
+				return nil, sr.corrupted(err)
+			}
+			if leaf.Data, err = sr.readBytes(length); err != nil {
+				return nil, err
+			}
+		}
+	}
+	expectedCRC := sr.crc.Sum32()
+	checksum := make([]byte, 4)
+	if err := sr.readFull(checksum); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(checksum) != expectedCRC {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptedSnapshot)
+	}
+
+	if int(count)%2 == 1 && !config.promoteOddNodes {
+		last := tree.Leaves[count-1]
+		tree.Leaves = append(tree.Leaves, &Node{Hash: last.Hash, Data: last.Data, IsLeaf: true, IsDuplicate: true})
+	}
+	if levelHashes != nil || tree.Depth <= 1 {
+		if err := tree.linkLevels(levelHashes, root); err != nil {
+			return nil, err
+		}
+		return &tree, nil
+	}
+	tree.Root = &Node{Hash: root}
+	tree.lazyRoot = root
+	if config.lazyLevels {
+		return &tree, nil
+	}
+	if err := tree.ensureLevels(); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+/*
+Builds the node graph above the leaves using stored hashes of levels 1 to Depth-1, checking them against root.
+*/
+func (t *MerkleTree) linkLevels(levelHashes [][][]byte, root []byte) error {
+	t.levels = [][]*Node{t.Leaves}
+	for level := 1; level <= t.Depth; level++ {
+		below := t.levels[level-1]
+		count := (len(below) + 1) / 2
+		parents := make([]*Node, count)
+		nodes := make([]Node, count)
+		for p := range parents {
+			left := below[2*p]
+			if 2*p+1 == len(below) && t.config.promoteOddNodes {
+				parents[p] = left
+				continue
+			}
+			right := left
+			if 2*p+1 < len(below) {
+				right = below[2*p+1]
+			}
+			node := &nodes[p]
+			node.Left, node.Right = left, right
+			if level < t.Depth {
+				node.Hash = levelHashes[level-1][p]
+			} else {
+				//Root is the only hash checked, hashes of the levels below are covered by the checksum
+				hash, err := t.hashNode(left.Hash, right.Hash)
+				if err != nil {
+					return err
+				}
+				node.Hash = hash
+			}
+			left.Parent = node
+			right.Parent = node
+			parents[p] = node
+		}
+		t.levels = append(t.levels, parents)
+	}
+	t.Root = t.levels[t.Depth][0]
+	if !bytes.Equal(t.Root.Hash, root) {
+		return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, ErrRootMismatch)
+	}
+	return nil
+}
+
+/*
+Builds interior levels of a tree loaded using WithLazyLevels, checking that they lead to the stored root.
+*/
+func (t *MerkleTree) ensureLevels() error {
+	if t.lazyRoot == nil {
+		return nil
+	}
+	t.levels = [][]*Node{t.Leaves}
+	root, err := buildIntermediateLevel(t.Leaves, t)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root.Hash, t.lazyRoot) {
+		return fmt.Errorf("%w: %w", ErrCorruptedSnapshot, ErrRootMismatch)
+	}
+	t.Root = root
+	t.lazyRoot = nil
+	return nil
+}
+
+/*
+Reads only the bytes of the snapshot, computing their checksum along the way.
+*/
+type snapshotReader struct {
+	r   io.Reader
+	crc hash.Hash32
+	buf [1]byte
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(sr.r, sr.buf[:]); err != nil {
+		return 0, err
+	}
+	sr.crc.Write(sr.buf[:])
+	return sr.buf[0], nil
+}
+
+func (sr *snapshotReader) readFull(p []byte) error {
+	if _, err := io.ReadFull(sr.r, p); err != nil {
+		return sr.corrupted(err)
+	}
+	sr.crc.Write(p)
+	return nil
+}
+
+func (sr *snapshotReader) readHashes(count int, size int) ([][]byte, error) {
+	perBatch := snapshotReadBatch / size
+	capacity := count
+	if capacity > perBatch {
+		capacity = perBatch
+	}
+	hashes := make([][]byte, 0, capacity)
+	for len(hashes) < count {
+		batch := count - len(hashes)
+		if batch > perBatch {
+			batch = perBatch
+		}
+		buf := make([]byte, batch*size)
+		if err := sr.readFull(buf); err != nil {
+			return nil, err
+		}
+		for i := 0; i < batch; i++ {
+			hashes = append(hashes, buf[i*size:(i+1)*size:(i+1)*size])
+		}
+	}
+	return hashes, nil
+}
+
+func (sr *snapshotReader) readBytes(length uint64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(sr.r, int64(length)))
+	if err != nil {
+		return nil, sr.corrupted(err)
+	}
+	if uint64(len(data)) != length {
+		return nil, sr.corrupted(io.ErrUnexpectedEOF)
+	}
+	sr.crc.Write(data)
+	return data, nil
+}
+
+func (sr *snapshotReader) corrupted(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated", ErrCorruptedSnapshot)
+	}
+	return err
+}
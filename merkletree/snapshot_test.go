@@ -0,0 +1,167 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// Checks that loaded has the same root, proofs and leaf data as tree.
+func assertSameTree(t *testing.T, loaded *MerkleTree, tree *MerkleTree, withData bool) {
+	t.Helper()
+	if !bytes.Equal(loaded.RootHash(), tree.RootHash()) || loaded.Depth != tree.Depth || loaded.LeafCount() != tree.LeafCount() {
+		t.Fatalf("Loaded tree with %d leaves doesn't match", tree.LeafCount())
+	}
+	if loaded.HashID != tree.HashID {
+		t.Fatalf("Loaded tree has hash %v, expected %v", loaded.HashID, tree.HashID)
+	}
+	for i := 0; i < tree.LeafCount(); i++ {
+		proof, err := loaded.GenerateMerkleProofByIndex(i)
+		if err != nil {
+			t.Fatalf("Failed to generate proof for leaf %d due to error %v", i, err)
+		}
+		expected, _ := tree.GenerateMerkleProofByIndex(i)
+		if equal, _ := proof.Equals(expected); !equal || len(proof.Hashes) != len(expected.Hashes) {
+			t.Fatalf("Proof for leaf %d of %d doesn't match", i, tree.LeafCount())
+		}
+		if withData && !bytes.Equal(loaded.Leaves[i].Data, tree.Leaves[i].Data) {
+			t.Fatalf("Data of leaf %d doesn't match", i)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	modes := [][]Option{nil, {WithDomainSeparation(), WithOddNodePromotion()}, {WithSortedLeaves(), WithSortedPairs()}}
+	contents := []SnapshotContent{0, SnapshotLevels, SnapshotLeafData, SnapshotLevels | SnapshotLeafData}
+	for _, opts := range modes {
+		for _, count := range []int{1, 2, 3, 8, 13} {
+			data := testData(count)
+			tree, err := NewTreeWithHash(&data, SHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			for _, content := range contents {
+				var buf bytes.Buffer
+				n, err := tree.WriteSnapshot(&buf, content)
+				if err != nil || n != int64(buf.Len()) {
+					t.Fatalf("Failed to write snapshot, wrote %d of %d bytes with error %v", n, buf.Len(), err)
+				}
+				loaded, err := ReadTree(&buf)
+				if err != nil {
+					t.Fatalf("Failed to read snapshot of %d leaves with content %d due to error %v", count, content, err)
+				}
+				assertSameTree(t, loaded, tree, content&SnapshotLeafData != 0)
+				if err := loaded.AppendLeaf([]byte("Appended")); err != nil {
+					t.Fatalf("Failed to append to loaded tree due to error %v", err)
+				}
+			}
+		}
+	}
+}
+
+func TestSnapshotHashFunc(t *testing.T) {
+	data := testData(6)
+	tree, _ := NewTree(&data, HashFuncSHA512)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	encoded := buf.Bytes()
+	if _, err := ReadTree(bytes.NewReader(encoded)); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported reading snapshot of unregistered hash function, got %v", err)
+	}
+	newer := append([]byte(nil), encoded...)
+	newer[4] = SnapshotVersion + 1
+	if _, err := ReadTreeWithHashFunc(bytes.NewReader(newer), HashFuncSHA512); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported reading snapshot of a newer version, got %v", err)
+	}
+	loaded, err := ReadTreeWithHashFunc(bytes.NewReader(encoded), HashFuncSHA512)
+	if err != nil {
+		t.Fatalf("Failed to read snapshot due to error %v", err)
+	}
+	assertSameTree(t, loaded, tree, true)
+
+	//Snapshots can be read back to back from the same reader
+	buf.Reset()
+	tree.WriteTo(&buf)
+	store := NewMemoryNodeStore()
+	stored, _ := NewTree(&data, HashFuncSHA512, WithNodeStore(store))
+	stored.WriteTo(&buf)
+	for i := 0; i < 2; i++ {
+		loaded, err := ReadTreeWithHashFunc(&buf, HashFuncSHA512)
+		if err != nil {
+			t.Fatalf("Failed to read snapshot %d due to error %v", i, err)
+		}
+		assertSameTree(t, loaded, tree, i == 0)
+	}
+}
+
+// Replaces the checksum at the end of a snapshot with the one of its content.
+func fixChecksum(snapshot []byte) {
+	crc := crc32.Checksum(snapshot[:len(snapshot)-4], crc32.MakeTable(crc32.Castagnoli))
+	binary.BigEndian.PutUint32(snapshot[len(snapshot)-4:], crc)
+}
+
+func TestSnapshotCorruption(t *testing.T) {
+	data := testData(9)
+	tree, _ := NewTreeWithHash(&data, SHA256)
+	var buf bytes.Buffer
+	tree.WriteSnapshot(&buf, 0)
+	encoded := buf.Bytes()
+	//Header is 7 bytes, uvarint hash size and leaf count take a byte each, followed by the 32 byte root
+	firstLeaf := 7 + 2 + 32
+
+	for _, truncated := range []int{0, 5, firstLeaf + 10, len(encoded) - 1} {
+		if _, err := ReadTree(bytes.NewReader(encoded[:truncated])); !errors.Is(err, ErrCorruptedSnapshot) {
+			t.Fatalf("Expected ErrCorruptedSnapshot for snapshot truncated to %d bytes, got %v", truncated, err)
+		}
+	}
+	flipped := append([]byte(nil), encoded...)
+	flipped[firstLeaf] ^= 1
+	if _, err := ReadTree(bytes.NewReader(flipped)); !errors.Is(err, ErrCorruptedSnapshot) {
+		t.Fatalf("Expected checksum failure, got %v", err)
+	}
+	fixChecksum(flipped)
+	if loaded, err := ReadTree(bytes.NewReader(flipped)); loaded != nil || !errors.Is(err, ErrCorruptedSnapshot) || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected root mismatch and no tree, got %v", err)
+	}
+	buf.Reset()
+	tree.WriteSnapshot(&buf, SnapshotLevels)
+	withLevels := append([]byte(nil), buf.Bytes()...)
+	//Stored levels are covered by the checksum, only the root is checked against them
+	withLevels[firstLeaf-1] ^= 1
+	fixChecksum(withLevels)
+	if loaded, err := ReadTree(bytes.NewReader(withLevels)); loaded != nil || !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected root mismatch and no tree for snapshot with levels, got %v", err)
+	}
+
+	lazy, err := ReadTree(bytes.NewReader(flipped), WithLazyLevels())
+	if err != nil {
+		t.Fatalf("Expected lazy load to defer root check, got %v", err)
+	}
+	if _, err := lazy.GenerateMerkleProofByIndex(0); !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Expected root mismatch building levels lazily, got %v", err)
+	}
+}
+
+func TestSnapshotLazyLevels(t *testing.T) {
+	data := testData(100)
+	tree, _ := NewTreeWithHash(&data, SHA256, WithOddNodePromotion())
+	var buf bytes.Buffer
+	tree.WriteSnapshot(&buf, 0)
+	loaded, err := ReadTree(&buf, WithLazyLevels())
+	if err != nil {
+		t.Fatalf("Failed to read snapshot due to error %v", err)
+	}
+	if loaded.levels != nil || !bytes.Equal(loaded.RootHash(), tree.RootHash()) {
+		t.Fatalf("Expected only leaves and root to be loaded")
+	}
+	proof, err := loaded.GenerateMultiProof([]int{3, 50})
+	if err != nil {
+		t.Fatalf("Failed to generate multiproof due to error %v", err)
+	}
+	if ok, err := tree.VerifyMultiProof([][]byte{data[3], data[50]}, proof); !ok {
+		t.Fatalf("Failed to verify multiproof from lazily loaded tree due to error %v", err)
+	}
+	assertSameTree(t, loaded, tree, false)
+}
@@ -0,0 +1,146 @@
+package merkletree
+
+import (
+	"bytes"
+	"sort"
+)
+
+/*
+Returns the position a leaf with the given hash takes in a tree built using WithSortedLeaves.
+*/
+func (t *MerkleTree) sortedPosition(hash []byte) (int, error) {
+	var err error
+	index := sort.Search(t.LeafCount(), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var leafHash []byte
+		leafHash, err = t.nodeHash(0, i)
+		return bytes.Compare(leafHash, hash) >= 0
+	})
+	return index, err
+}
+
+/*
+Inserts a leaf at its sorted position, shifting the leaves after it one position right.
+*/
+func (t *MerkleTree) insertSortedLeaf(data []byte, hash []byte) error {
+	index, err := t.sortedPosition(hash)
+	if err != nil {
+		return err
+	}
+	if t.config.store != nil {
+		return t.storeInsertLeaf(index, hash)
+	}
+	count := t.LeafCount()
+	leaf, err := buildLeafNode(data, hash, t)
+	if err != nil {
+		return err
+	}
+	for i := count - 1; i >= index; i-- {
+		t.leafIndex.remove(t.Leaves[i].Hash, i)
+		t.leafIndex.add(t.Leaves[i].Hash, i+1)
+	}
+	t.leafIndex.add(hash, index)
+
+	leaves := make([]*Node, 0, count+2)
+	leaves = append(leaves, t.Leaves[:index]...)
+	leaves = append(leaves, leaf)
+	leaves = append(leaves, t.Leaves[index:count]...)
+	if t.config.needsPadLeaf(len(leaves)) {
+		// Handle case of odd leaves. Create a duplicate leaf node
+		last := leaves[len(leaves)-1]
+		pad, err := buildLeafNode(last.Data, last.Hash, t)
+		if err != nil {
+			return err
+		}
+		pad.IsDuplicate = true
+		leaves = append(leaves, pad)
+	}
+	t.Leaves = leaves
+	return t.rebuildFrom(index)
+}
+
+/*
+Replaces the leaf at index with a leaf holding data and moves it to the sorted position of hash,
+shifting the leaves in between by one position. The leaf count never changes, and if rebuilding fails
+the previous leaves and links between nodes are restored, so a failed update leaves the tree as it was.
+*/
+func (t *MerkleTree) moveSortedLeaf(index int, data []byte, hash []byte) error {
+	position, err := t.sortedPosition(hash)
+	if err != nil {
+		return err
+	}
+	//Position among the other leaves, the leaf at index being taken out
+	if position > index {
+		position--
+	}
+	if t.config.store != nil {
+		return t.storeMoveLeaf(index, position, hash)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return err
+	}
+	count := t.LeafCount()
+	leaf, err := buildLeafNode(data, hash, t)
+	if err != nil {
+		return err
+	}
+	leaves := make([]*Node, 0, count+1)
+	leaves = append(leaves, t.Leaves[:index]...)
+	leaves = append(leaves, t.Leaves[index+1:count]...)
+	leaves = append(leaves[:position], append([]*Node{leaf}, leaves[position:]...)...)
+	if t.config.needsPadLeaf(len(leaves)) {
+		last := leaves[len(leaves)-1]
+		pad, err := buildLeafNode(last.Data, last.Hash, t)
+		if err != nil {
+			return err
+		}
+		pad.IsDuplicate = true
+		leaves = append(leaves, pad)
+	}
+
+	first, last := index, position
+	if first > last {
+		first, last = last, first
+	}
+	previous := t.Leaves
+	t.Leaves = leaves
+	if err := t.rebuildFrom(first); err != nil {
+		t.Leaves = previous
+		t.relinkLevels()
+		return err
+	}
+	for i := first; i <= last; i++ {
+		t.leafIndex.remove(previous[i].Hash, i)
+	}
+	for i := first; i <= last; i++ {
+		t.leafIndex.add(leaves[i].Hash, i)
+	}
+	previous[index].Parent = nil
+	return nil
+}
+
+/*
+Points every node of levels back to its parent, undoing links changed by a failed rebuild.
+*/
+func (t *MerkleTree) relinkLevels() {
+	for _, level := range t.levels[1:] {
+		for _, parent := range level {
+			if parent == nil || parent.IsLeaf {
+				continue
+			}
+			if parent.Children != nil {
+				for _, child := range parent.Children {
+					child.Parent = parent
+				}
+				continue
+			}
+			parent.Left.Parent = parent
+			parent.Right.Parent = parent
+		}
+	}
+	if t.Root != nil {
+		t.Root.Parent = nil
+	}
+}
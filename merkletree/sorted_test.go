@@ -0,0 +1,164 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestSortedLeavesOrderIndependent(t *testing.T) {
+	for _, opts := range [][]Option{{WithSortedLeaves()}, {WithSortedLeaves(), WithOddNodePromotion()}} {
+		for _, count := range []int{1, 2, 5, 8, 13} {
+			data := testData(count)
+			expected, err := NewTree(&data, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			shuffled := append(Data(nil), data...)
+			rand.New(rand.NewSource(int64(count))).Shuffle(count, func(i, j int) {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			})
+			tree, err := NewTree(&shuffled, HashFuncSHA256, opts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+				t.Fatalf("Root of %d shuffled leaves doesn't match", count)
+			}
+			storeOpts := append([]Option{WithNodeStore(NewMemoryNodeStore())}, opts...)
+			stored, err := NewTree(&shuffled, HashFuncSHA256, storeOpts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			assertMatchesInMemory(t, stored, sortedData(data), opts...)
+		}
+	}
+}
+
+func TestSortedPairs(t *testing.T) {
+	data := Data{[]byte("Hello"), []byte("World")}
+	tree, err := NewTree(&data, HashFuncSHA256, WithSortedPairs())
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	left, _ := HashFuncSHA256(data[0])
+	right, _ := HashFuncSHA256(data[1])
+	if bytes.Compare(left, right) > 0 {
+		left, right = right, left
+	}
+	expected, _ := HashFuncSHA256(append(append([]byte(nil), left...), right...))
+	if !bytes.Equal(tree.RootHash(), expected) {
+		t.Fatalf("Root doesn't match hash of the sorted pair")
+	}
+
+	opts := []Option{WithSortedLeaves(), WithSortedPairs(), WithDomainSeparation()}
+	data = testData(11)
+	tree, err = NewTree(&data, HashFuncSHA256, opts...)
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	for i := range data {
+		proof, err := tree.GenerateMerkleProof(&data[i])
+		if err != nil {
+			t.Fatalf("Failed to generate proof due to error %v", err)
+		}
+		//Only hashes are needed to verify
+		if ok, err := VerifyProof(tree.RootHash(), data[i], &Proof{Hashes: proof.Hashes}, HashFuncSHA256, opts...); !ok {
+			t.Fatalf("Failed to verify proof without indexes for leaf %d due to error %v", i, err)
+		}
+		flipped := Proof{Hashes: proof.Hashes, Indexes: make([]int, len(proof.Indexes))}
+		for j, index := range proof.Indexes {
+			flipped.Indexes[j] = 1 - index
+		}
+		if ok, err := tree.VerifyProof(&data[i], &flipped); !ok {
+			t.Fatalf("Failed to verify proof with flipped indexes for leaf %d due to error %v", i, err)
+		}
+	}
+	forged := []byte("Forged")
+	proof, _ := tree.GenerateMerkleProof(&data[0])
+	if ok, _ := VerifyProof(tree.RootHash(), forged, &Proof{Hashes: proof.Hashes}, HashFuncSHA256, opts...); ok {
+		t.Fatalf("Expected proof for data not in the tree to fail")
+	}
+}
+
+func TestSortedLeavesModify(t *testing.T) {
+	for _, opts := range [][]Option{{WithSortedLeaves()}, {WithSortedLeaves(), WithOddNodePromotion()}} {
+		data := testData(6)
+		tree, err := NewTree(&data, HashFuncSHA256, opts...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		stored, err := NewTree(&data, HashFuncSHA256, append([]Option{WithNodeStore(NewMemoryNodeStore())}, opts...)...)
+		if err != nil {
+			t.Fatalf("Failed to build Tree due to error %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			value := []byte{byte(i * 50)}
+			data = append(data, value)
+			for _, tr := range []*MerkleTree{tree, stored} {
+				if err := tr.AppendLeaf(value); err != nil {
+					t.Fatalf("Failed to append leaf due to error %v", err)
+				}
+			}
+			assertMatchesRebuilt(t, tree, sortedData(data), opts...)
+			assertMatchesInMemory(t, stored, sortedData(data), opts...)
+		}
+		old := data[2]
+		data[2] = []byte("Updated")
+		for _, tr := range []*MerkleTree{tree, stored} {
+			if err := tr.UpdateLeaf(&old, &data[2]); err != nil {
+				t.Fatalf("Failed to update leaf due to error %v", err)
+			}
+		}
+		assertMatchesRebuilt(t, tree, sortedData(data), opts...)
+		assertMatchesInMemory(t, stored, sortedData(data), opts...)
+	}
+}
+
+func TestSortedLeavesFailedUpdate(t *testing.T) {
+	failing := false
+	//Fails hashing non-leaf nodes, so the new leaf hash is computed but rebuilding the levels above it fails
+	hashFunc := func(data []byte) ([]byte, error) {
+		if failing && data[0] == nodeHashPrefix {
+			return nil, errors.New("hash failed")
+		}
+		return HashFuncSHA256(data)
+	}
+	opts := []Option{WithSortedLeaves(), WithDomainSeparation()}
+	for _, count := range []int{6, 7} {
+		data := testData(count)
+		tree, _ := NewTree(&data, hashFunc, opts...)
+		leaves := make(Data, count)
+		for i := range leaves {
+			leaves[i] = tree.Leaves[i].Data
+		}
+		failing = true
+		for _, index := range []int{0, count / 2, count - 1} {
+			if err := tree.UpdateLeafAt(index, []byte("Updated")); err == nil {
+				t.Fatalf("Expected update of leaf %d to fail", index)
+			}
+		}
+		failing = false
+		//Rebuilt without sorting, leaves are passed in the order the tree holds them
+		assertMatchesRebuilt(t, tree, leaves, WithDomainSeparation())
+		if err := tree.UpdateLeafAt(count/2, []byte("Updated")); err != nil {
+			t.Fatalf("Failed to update leaf after failed updates due to error %v", err)
+		}
+		leaves[count/2] = []byte("Updated")
+		expected, _ := NewTree(&leaves, hashFunc, opts...)
+		if !bytes.Equal(tree.RootHash(), expected.RootHash()) {
+			t.Fatalf("Root after update doesn't match rebuilt tree")
+		}
+	}
+}
+
+// Returns data ordered as leaves of a tree built using WithSortedLeaves.
+func sortedData(data Data) Data {
+	tree, _ := NewTree(&data, HashFuncSHA256, WithSortedLeaves())
+	sorted := make(Data, tree.LeafCount())
+	for i := range sorted {
+		sorted[i] = tree.Leaves[i].Data
+	}
+	return sorted
+}
@@ -0,0 +1,343 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	//Size in bytes of keys in a SparseMerkleTree
+	SparseKeySize = 32
+	//Number of levels below the root of a SparseMerkleTree, one per key bit
+	SparseTreeDepth = SparseKeySize * 8
+)
+
+/*
+Sparse merkle tree with a leaf for every possible 256 bit key, most of which are empty.
+The path from the root to a leaf follows the bits of its key, most significant bit first, 0 being left.
+Only non-empty nodes are stored, hashes of empty subtrees are computed once per level and reused.
+*/
+type SparseMerkleTree struct {
+	HashFunc HashFunction
+	config   treeConfig
+	//Hash of an empty subtree with its root at each level, level 0 being the leaves
+	defaults [][]byte
+	//Hashes of non-empty nodes keyed by level and key prefix
+	nodes  map[string][]byte
+	values map[string][]byte
+}
+
+/*
+Creates an empty sparse merkle tree.
+Empty leaves are represented by an all zero hash, which no value is expected to hash to.
+Accepts
+  - Hash function to be used for hashing
+  - Optional settings, only WithDomainSeparation applies to sparse trees
+
+Returns
+  - Reference to the tree in case of no errors
+  - error in case hash function is not secure enough or any other option is passed
+*/
+func NewSparseTree(hashFunc HashFunction, opts ...Option) (*SparseMerkleTree, error) {
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	config, err := newSparseConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	tree := SparseMerkleTree{
+		HashFunc: hashFunc,
+		config:   config,
+		defaults: make([][]byte, SparseTreeDepth+1),
+		nodes:    make(map[string][]byte),
+		values:   make(map[string][]byte),
+	}
+	//Hash anything to learn the hash size
+	sample, err := hashFunc(nil)
+	if err != nil {
+		return nil, err
+	}
+	tree.defaults[0] = make([]byte, len(sample))
+	for level := 1; level <= SparseTreeDepth; level++ {
+		tree.defaults[level], err = tree.config.hashNode(hashFunc, tree.defaults[level-1], tree.defaults[level-1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &tree, nil
+}
+
+func (t *SparseMerkleTree) RootHash() []byte {
+	return t.node(SparseTreeDepth, make([]byte, SparseKeySize))
+}
+
+/*
+Returns the number of keys set in the tree.
+*/
+func (t *SparseMerkleTree) Len() int {
+	return len(t.values)
+}
+
+/*
+Returns the value stored for key.
+Accepts
+  - 32 byte key
+
+Returns
+  - value stored for the key
+  - error in case key is invalid or not present in the tree
+*/
+func (t *SparseMerkleTree) Get(key []byte) ([]byte, error) {
+	if err := checkSparseKey(key); err != nil {
+		return nil, err
+	}
+	value, found := t.values[string(key)]
+	if !found {
+		return nil, ErrLeafNotFound
+	}
+	return value, nil
+}
+
+/*
+Stores value for key, replacing any existing value, and recomputes hashes along its path to the root.
+Accepts
+  - 32 byte key
+  - value to be stored for the key
+
+Returns
+  - error in case any error occurs or key is invalid
+*/
+func (t *SparseMerkleTree) Set(key []byte, value []byte) error {
+	if err := checkSparseKey(key); err != nil {
+		return err
+	}
+	leafHash, err := t.config.hashLeaf(t.HashFunc, value)
+	if err != nil {
+		return err
+	}
+	if err := t.updatePath(key, leafHash); err != nil {
+		return err
+	}
+	t.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+/*
+Removes key from the tree, turning its leaf back into an empty one.
+Accepts
+  - 32 byte key
+
+Returns
+  - error in case any error occurs or key is invalid or not present in the tree
+*/
+func (t *SparseMerkleTree) Delete(key []byte) error {
+	if err := checkSparseKey(key); err != nil {
+		return err
+	}
+	if _, found := t.values[string(key)]; !found {
+		return ErrLeafNotFound
+	}
+	if err := t.updatePath(key, t.defaults[0]); err != nil {
+		return err
+	}
+	delete(t.values, string(key))
+	return nil
+}
+
+/*
+Generates a proof for key. Proof shows inclusion of the value if key is present, and non-inclusion otherwise.
+Proof contains SparseTreeDepth sibling hashes from the leaf to the root, using the same layout as Proof generated by MerkleTree.
+Accepts
+  - 32 byte key
+
+Returns
+  - Reference to a Proof object
+  - error in case key is invalid
+*/
+func (t *SparseMerkleTree) GenerateProof(key []byte) (*Proof, error) {
+	if err := checkSparseKey(key); err != nil {
+		return nil, err
+	}
+	proof := Proof{
+		Hashes:  make([][]byte, SparseTreeDepth),
+		Indexes: make([]int, SparseTreeDepth),
+	}
+	for level := 0; level < SparseTreeDepth; level++ {
+		proof.Hashes[level] = t.node(level, siblingKey(key, level))
+		proof.Indexes[level] = 1 - keyBit(key, level)
+	}
+	return &proof, nil
+}
+
+/*
+Verifies that key holds value in the sparse merkle tree with the given root.
+Options should be the same ones the tree was built with.
+Accepts
+  - trusted root hash of the tree
+  - 32 byte key
+  - value expected for the key
+  - Proof object generated for the key
+  - Hash function the tree was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed, is for a different key or doesn't lead to root, ErrUnsupported for options other
+    than WithDomainSeparation, error from hash function otherwise
+*/
+func VerifySparseInclusion(root []byte, key []byte, value []byte, proof *Proof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config, err := newSparseConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if err := checkSparseProof(key, proof); err != nil {
+		return false, err
+	}
+	leafHash, err := config.hashLeaf(hashFunc, value)
+	if err != nil {
+		return false, err
+	}
+	return verifyProofFromLeafHash(root, leafHash, proof, hashFunc, &config)
+}
+
+/*
+Verifies that key is not present in the sparse merkle tree with the given root.
+Options should be the same ones the tree was built with.
+Accepts
+  - trusted root hash of the tree
+  - 32 byte key
+  - Proof object generated for the key
+  - Hash function the tree was built with
+
+Returns
+  - true if proof is valid
+  - *ProofError if proof is malformed, is for a different key or doesn't lead to root, ErrUnsupported for options other
+    than WithDomainSeparation, error from hash function otherwise
+*/
+func VerifySparseNonInclusion(root []byte, key []byte, proof *Proof, hashFunc HashFunction, opts ...Option) (bool, error) {
+	config, err := newSparseConfig(opts)
+	if err != nil {
+		return false, err
+	}
+	if err := checkSparseProof(key, proof); err != nil {
+		return false, err
+	}
+	if len(proof.Hashes[0]) == 0 {
+		return false, &ProofError{Err: ErrMalformedProof, Detail: "empty sibling hash"}
+	}
+	emptyLeaf := make([]byte, len(proof.Hashes[0]))
+	return verifyProofFromLeafHash(root, emptyLeaf, proof, hashFunc, &config)
+}
+
+/*
+Returns config of opts, error if any option other than WithDomainSeparation is passed as the others don't apply to sparse trees.
+*/
+func newSparseConfig(opts []Option) (treeConfig, error) {
+	config := newTreeConfig(opts)
+	if config.promoteOddNodes || config.workers != 0 || config.store != nil || config.sortedLeaves || config.sortedPairs ||
+		config.lazyLevels || config.branching != 0 || config.digests != nil {
+		return treeConfig{}, fmt.Errorf("%w: only WithDomainSeparation applies to sparse trees", ErrUnsupported)
+	}
+	return config, nil
+}
+
+func checkSparseKey(key []byte) error {
+	if len(key) != SparseKeySize {
+		return fmt.Errorf("%w: key must be %d bytes, got %d", ErrUnsupported, SparseKeySize, len(key))
+	}
+	return nil
+}
+
+func checkSparseProof(key []byte, proof *Proof) error {
+	if err := checkSparseKey(key); err != nil {
+		return err
+	}
+	if proof == nil {
+		return &ProofError{Err: ErrMalformedProof, Detail: "proof is nil"}
+	}
+	if err := proof.validate(); err != nil {
+		return err
+	}
+	if len(proof.Hashes) != SparseTreeDepth {
+		return &ProofError{Err: ErrMalformedProof,
+			Detail: fmt.Sprintf("sparse proof must have %d hashes, got %d", SparseTreeDepth, len(proof.Hashes))}
+	}
+	//Indexes are implied by the key, a mismatch means the proof is for a different key.
+	for level, index := range proof.Indexes {
+		if index != 1-keyBit(key, level) {
+			return &ProofError{Err: ErrMalformedProof, Detail: fmt.Sprintf("proof is not for this key at level %d", level)}
+		}
+	}
+	return nil
+}
+
+/*
+Sets the leaf for key to leafHash and recomputes its ancestors. Nodes hashing to an empty subtree are not stored.
+*/
+func (t *SparseMerkleTree) updatePath(key []byte, leafHash []byte) error {
+	hash := leafHash
+	var err error
+	for level := 0; level < SparseTreeDepth; level++ {
+		t.setNode(level, key, hash)
+		sibling := t.node(level, siblingKey(key, level))
+		if keyBit(key, level) == 0 {
+			hash, err = t.config.hashNode(t.HashFunc, hash, sibling)
+		} else {
+			hash, err = t.config.hashNode(t.HashFunc, sibling, hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	t.setNode(SparseTreeDepth, key, hash)
+	return nil
+}
+
+func (t *SparseMerkleTree) node(level int, key []byte) []byte {
+	if hash, found := t.nodes[nodeKey(level, key)]; found {
+		return hash
+	}
+	return t.defaults[level]
+}
+
+func (t *SparseMerkleTree) setNode(level int, key []byte, hash []byte) {
+	if bytes.Equal(hash, t.defaults[level]) {
+		delete(t.nodes, nodeKey(level, key))
+		return
+	}
+	t.nodes[nodeKey(level, key)] = hash
+}
+
+/*
+Returns the bit of key deciding whether the node at level on its path is a left (0) or right (1) child.
+*/
+func keyBit(key []byte, level int) int {
+	return int(key[SparseKeySize-1-level/8]>>(level%8)) & 1
+}
+
+/*
+Returns key of the sibling of the node at level on the path of key.
+*/
+func siblingKey(key []byte, level int) []byte {
+	sibling := append([]byte{}, key...)
+	sibling[SparseKeySize-1-level/8] ^= 1 << (level % 8)
+	return sibling
+}
+
+/*
+Identifies the node at level on the path of key by the level and the key bits above it.
+*/
+func nodeKey(level int, key []byte) string {
+	buf := make([]byte, 2+SparseKeySize)
+	binary.BigEndian.PutUint16(buf, uint16(level))
+	copy(buf[2:], key)
+	prefix := buf[2:]
+	for i := 0; i < level/8; i++ {
+		prefix[SparseKeySize-1-i] = 0
+	}
+	if level < SparseTreeDepth {
+		prefix[SparseKeySize-1-level/8] &^= 1<<(level%8) - 1
+	}
+	return string(buf)
+}
@@ -0,0 +1,150 @@
+package merkletree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func sparseKey(i int) []byte {
+	key := sha256.Sum256([]byte(fmt.Sprintf("key%d", i)))
+	return key[:]
+}
+
+func TestSparseTreeSetGetDelete(t *testing.T) {
+	tree, err := NewSparseTree(HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to create sparse tree due to error %v", err)
+	}
+	emptyRoot := tree.RootHash()
+	if !bytes.Equal(emptyRoot, tree.defaults[SparseTreeDepth]) {
+		t.Fatalf("Root of empty tree doesn't match cached empty subtree hash")
+	}
+	for i := 0; i < 50; i++ {
+		if err := tree.Set(sparseKey(i), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatalf("Failed to set key %d due to error %v", i, err)
+		}
+	}
+	if tree.Len() != 50 {
+		t.Fatalf("Expected 50 keys, got %d", tree.Len())
+	}
+	for i := 0; i < 50; i++ {
+		value, err := tree.Get(sparseKey(i))
+		if err != nil || string(value) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Unexpected value %q for key %d, error %v", value, i, err)
+		}
+	}
+	if _, err := tree.Get(sparseKey(50)); err == nil {
+		t.Fatalf("Expected error getting absent key")
+	}
+
+	//Root doesn't depend on insertion order
+	reversed, _ := NewSparseTree(HashFuncSHA256)
+	for i := 49; i >= 0; i-- {
+		reversed.Set(sparseKey(i), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if !bytes.Equal(tree.RootHash(), reversed.RootHash()) {
+		t.Fatalf("Root depends on insertion order")
+	}
+
+	root := tree.RootHash()
+	tree.Set(sparseKey(3), []byte("changed"))
+	if bytes.Equal(root, tree.RootHash()) {
+		t.Fatalf("Expected root to change when a value changes")
+	}
+	tree.Set(sparseKey(3), []byte("value3"))
+	if !bytes.Equal(root, tree.RootHash()) {
+		t.Fatalf("Expected root to be restored when a value is restored")
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := tree.Delete(sparseKey(i)); err != nil {
+			t.Fatalf("Failed to delete key %d due to error %v", i, err)
+		}
+	}
+	if !bytes.Equal(tree.RootHash(), emptyRoot) || len(tree.nodes) != 0 || tree.Len() != 0 {
+		t.Fatalf("Expected empty tree after deleting all keys, %d nodes left", len(tree.nodes))
+	}
+	if err := tree.Delete(sparseKey(0)); err == nil {
+		t.Fatalf("Expected error deleting absent key")
+	}
+	if err := tree.Set([]byte("short"), []byte("value")); err == nil {
+		t.Fatalf("Expected error setting key of invalid size")
+	}
+}
+
+func TestSparseTreeProofs(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithDomainSeparation()}} {
+		tree, _ := NewSparseTree(HashFuncSHA256, opts...)
+		for i := 0; i < 20; i++ {
+			tree.Set(sparseKey(i), []byte(fmt.Sprintf("value%d", i)))
+		}
+		//Keys differing only in the last bit share all but the leaf level
+		neighbour := sparseKey(0)
+		neighbour[SparseKeySize-1] ^= 1
+		tree.Set(neighbour, []byte("neighbour"))
+		root := tree.RootHash()
+
+		for i := 0; i < 20; i++ {
+			proof, err := tree.GenerateProof(sparseKey(i))
+			if err != nil {
+				t.Fatalf("Failed to generate proof due to error %v", err)
+			}
+			value := []byte(fmt.Sprintf("value%d", i))
+			if verified, err := VerifySparseInclusion(root, sparseKey(i), value, proof, HashFuncSHA256, opts...); !verified {
+				t.Fatalf("Failed to verify inclusion of key %d due to error %v", i, err)
+			}
+			if verified, err := VerifySparseInclusion(root, sparseKey(i), []byte("wrong"), proof, HashFuncSHA256, opts...); verified || !errors.Is(err, ErrRootMismatch) {
+				t.Fatalf("Expected ErrRootMismatch for wrong value, got %t, %v", verified, err)
+			}
+			if verified, _ := VerifySparseNonInclusion(root, sparseKey(i), proof, HashFuncSHA256, opts...); verified {
+				t.Fatalf("Non-inclusion must not verify for present key %d", i)
+			}
+			if verified, err := VerifySparseInclusion(root, sparseKey(i+100), value, proof, HashFuncSHA256, opts...); verified || !errors.Is(err, ErrMalformedProof) {
+				t.Fatalf("Expected ErrMalformedProof for proof of a different key, got %t, %v", verified, err)
+			}
+		}
+		proof, _ := tree.GenerateProof(neighbour)
+		if verified, err := VerifySparseInclusion(root, neighbour, []byte("neighbour"), proof, HashFuncSHA256, opts...); !verified {
+			t.Fatalf("Failed to verify inclusion of neighbour key due to error %v", err)
+		}
+
+		for i := 100; i < 110; i++ {
+			proof, err := tree.GenerateProof(sparseKey(i))
+			if err != nil {
+				t.Fatalf("Failed to generate proof due to error %v", err)
+			}
+			if verified, err := VerifySparseNonInclusion(root, sparseKey(i), proof, HashFuncSHA256, opts...); !verified {
+				t.Fatalf("Failed to verify non-inclusion of key %d due to error %v", i, err)
+			}
+			encoded, _ := proof.MarshalBinary()
+			var decoded Proof
+			if err := decoded.UnmarshalBinary(encoded); err != nil {
+				t.Fatalf("Failed to decode sparse proof due to error %v", err)
+			}
+			if verified, err := VerifySparseNonInclusion(root, sparseKey(i), &decoded, HashFuncSHA256, opts...); !verified {
+				t.Fatalf("Failed to verify decoded non-inclusion proof due to error %v", err)
+			}
+		}
+	}
+}
+
+func TestSparseTreeUnsupportedOptions(t *testing.T) {
+	tree, _ := NewSparseTree(HashFuncSHA256)
+	tree.Set(sparseKey(1), []byte("value"))
+	inclusion, _ := tree.GenerateProof(sparseKey(1))
+	exclusion, _ := tree.GenerateProof(sparseKey(2))
+	for _, opt := range []Option{WithBranching(4), WithSortedPairs(), WithOddNodePromotion(), WithWorkers(2), WithNodeStore(NewMemoryNodeStore())} {
+		if _, err := NewSparseTree(HashFuncSHA256, opt); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("Expected ErrUnsupported creating sparse tree with option, got %v", err)
+		}
+		if verified, err := VerifySparseInclusion(tree.RootHash(), sparseKey(1), []byte("value"), inclusion, HashFuncSHA256, opt); verified || !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("Expected ErrUnsupported verifying inclusion with option, got %t, %v", verified, err)
+		}
+		if verified, err := VerifySparseNonInclusion(tree.RootHash(), sparseKey(2), exclusion, HashFuncSHA256, opt); verified || !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("Expected ErrUnsupported verifying non-inclusion with option, got %t, %v", verified, err)
+		}
+	}
+}
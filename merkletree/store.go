@@ -0,0 +1,106 @@
+package merkletree
+
+import "fmt"
+
+/*
+Storage for node hashes of a MerkleTree, addressed by position.
+A node's position is its level, 0 being the leaves, and its index within that level.
+Trees built using WithNodeStore keep no nodes in memory and run every operation through the store,
+so a store that persists its content lets a tree be reopened using OpenTree.
+*/
+type NodeStore interface {
+	//Returns hash of the node at index of level
+	GetNode(level int, index int) ([]byte, error)
+	//Stores hash of the node at index of level, replacing any earlier hash
+	PutNode(level int, index int, hash []byte) error
+	//Returns position of the first leaf below LeafCount with the given hash
+	FindLeaf(hash []byte) (int, bool)
+	//Returns number of leaves in the tree
+	LeafCount() int
+	//Sets number of leaves in the tree, leaves from count onwards are no longer part of it
+	SetLeafCount(count int) error
+}
+
+/*
+NodeStore applying writes as a group. Trees commit once an operation has written all of its nodes,
+so that a store reopened after a crash holds the tree as it was after its last committed operation.
+*/
+type CommitNodeStore interface {
+	NodeStore
+	//Makes writes since the previous commit part of the stored tree
+	Commit() error
+}
+
+/*
+Builds the tree in the given store instead of keeping nodes in memory.
+Root of the tree holds only the root hash and Leaves is empty, leaf data is not kept.
+Store must be empty when building a tree, use OpenTree to load a tree from a store.
+*/
+func WithNodeStore(store NodeStore) Option {
+	return func(c *treeConfig) {
+		c.store = store
+	}
+}
+
+/*
+NodeStore keeping node hashes in memory.
+*/
+type MemoryNodeStore struct {
+	levels    [][][]byte
+	leaves    hashIndex
+	leafCount int
+}
+
+func NewMemoryNodeStore() *MemoryNodeStore {
+	return &MemoryNodeStore{leaves: make(hashIndex)}
+}
+
+func (s *MemoryNodeStore) GetNode(level int, index int) ([]byte, error) {
+	if level < 0 || level >= len(s.levels) || index < 0 || index >= len(s.levels[level]) || s.levels[level][index] == nil {
+		return nil, fmt.Errorf("%w: level %d index %d", ErrNodeNotFound, level, index)
+	}
+	return s.levels[level][index], nil
+}
+
+func (s *MemoryNodeStore) PutNode(level int, index int, hash []byte) error {
+	if level < 0 || index < 0 {
+		return fmt.Errorf("%w: invalid node position level %d index %d", ErrIndexOutOfRange, level, index)
+	}
+	for len(s.levels) <= level {
+		s.levels = append(s.levels, nil)
+	}
+	for len(s.levels[level]) <= index {
+		s.levels[level] = append(s.levels[level], nil)
+	}
+	if level == 0 {
+		if old := s.levels[0][index]; old != nil {
+			s.leaves.remove(old, index)
+		}
+		s.leaves.add(hash, index)
+	}
+	s.levels[level][index] = hash
+	return nil
+}
+
+func (s *MemoryNodeStore) FindLeaf(hash []byte) (int, bool) {
+	return s.leaves.first(hash)
+}
+
+func (s *MemoryNodeStore) LeafCount() int {
+	return s.leafCount
+}
+
+func (s *MemoryNodeStore) SetLeafCount(count int) error {
+	if len(s.levels) > 0 {
+		for i := count; i < len(s.levels[0]); i++ {
+			if s.levels[0][i] != nil {
+				s.leaves.remove(s.levels[0][i], i)
+			}
+		}
+		if count < len(s.levels[0]) {
+			s.levels[0] = s.levels[0][:count]
+		}
+	}
+	s.leafCount = count
+	return nil
+}
@@ -0,0 +1,327 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Checks that store backed tree produces the same root, proofs and paths as an in-memory tree built from data.
+func assertMatchesInMemory(t *testing.T, tree *MerkleTree, data Data, opts ...Option) {
+	t.Helper()
+	expected := assertRootMatchesRebuilt(t, tree, data, opts...)
+	for i := range data {
+		proof, err := tree.GenerateMerkleProofByIndex(i)
+		if err != nil {
+			t.Fatalf("Failed to generate proof for leaf %d due to error %v", i, err)
+		}
+		expectedProof, _ := expected.GenerateMerkleProofByIndex(i)
+		if equal, _ := proof.Equals(expectedProof); !equal {
+			t.Fatalf("Proof for leaf %d of %d doesn't match in-memory tree", i, len(data))
+		}
+		path, err := tree.GetMerklePath(&data[i])
+		if err != nil {
+			t.Fatalf("Failed to generate path for leaf %d due to error %v", i, err)
+		}
+		expectedPath, _ := expected.GetMerklePath(&data[i])
+		if equal, _ := path.Equals(expectedPath); !equal {
+			t.Fatalf("Path for leaf %d of %d doesn't match in-memory tree", i, len(data))
+		}
+	}
+}
+
+func TestNodeStoreTree(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithOddNodePromotion()}, {WithDomainSeparation(), WithOddNodePromotion()}} {
+		for count := 1; count <= 17; count++ {
+			data := testData(count)
+			storeOpts := append([]Option{WithNodeStore(NewMemoryNodeStore())}, opts...)
+			tree, err := NewTree(&data, HashFuncSHA256, storeOpts...)
+			if err != nil {
+				t.Fatalf("Failed to build Tree due to error %v", err)
+			}
+			assertMatchesInMemory(t, tree, data, opts...)
+			proof, err := tree.GenerateMultiProof([]int{0, count / 2})
+			if err != nil {
+				t.Fatalf("Failed to generate multiproof due to error %v", err)
+			}
+			leaves := [][]byte{data[0], data[count/2]}
+			if count == 1 {
+				leaves = leaves[:1]
+			}
+			if ok, err := tree.VerifyMultiProof(leaves, proof); !ok {
+				t.Fatalf("Failed to verify multiproof for %d leaves due to error %v", count, err)
+			}
+			if len(opts) > 0 {
+				consistency, err := tree.GenerateConsistencyProof(1, count)
+				if err != nil {
+					t.Fatalf("Failed to generate consistency proof due to error %v", err)
+				}
+				expected, _ := NewTree(&data, HashFuncSHA256, opts...)
+				expectedConsistency, _ := expected.GenerateConsistencyProof(1, count)
+				if len(consistency.Hashes) != len(expectedConsistency.Hashes) {
+					t.Fatalf("Consistency proof for %d leaves doesn't match in-memory tree", count)
+				}
+				for i := range consistency.Hashes {
+					if !bytes.Equal(consistency.Hashes[i], expectedConsistency.Hashes[i]) {
+						t.Fatalf("Consistency proof for %d leaves doesn't match in-memory tree", count)
+					}
+				}
+			}
+
+			data[count/2] = []byte("Updated")
+			if err := tree.UpdateLeafAt(count/2, data[count/2]); err != nil {
+				t.Fatalf("Failed to update leaf due to error %v", err)
+			}
+			assertMatchesInMemory(t, tree, data, opts...)
+			data = append(data, []byte("Appended"))
+			if err := tree.AppendLeaf(data[count]); err != nil {
+				t.Fatalf("Failed to append leaf due to error %v", err)
+			}
+			assertMatchesInMemory(t, tree, data, opts...)
+			if err := tree.RemoveLeafAt(0); err != nil {
+				t.Fatalf("Failed to remove leaf due to error %v", err)
+			}
+			data = data[1:]
+			assertMatchesInMemory(t, tree, data, opts...)
+		}
+	}
+}
+
+func TestNodeStoreNotEmpty(t *testing.T) {
+	data := testData(4)
+	store := NewMemoryNodeStore()
+	if _, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store)); err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	if _, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store)); err == nil {
+		t.Fatalf("Expected error building a tree in a store already holding one")
+	}
+	if _, err := OpenTree(NewMemoryNodeStore(), HashFuncSHA256); err == nil {
+		t.Fatalf("Expected error opening a tree from an empty store")
+	}
+}
+
+func TestFileNodeStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	store, err := OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store due to error %v", err)
+	}
+	data := testData(9)
+	tree, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	old := data[3]
+	data[3] = []byte("Updated")
+	if err := tree.UpdateLeaf(&old, &data[3]); err != nil {
+		t.Fatalf("Failed to update leaf due to error %v", err)
+	}
+	if err := tree.RemoveLeafAt(8); err != nil {
+		t.Fatalf("Failed to remove leaf due to error %v", err)
+	}
+	data = data[:8]
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store due to error %v", err)
+	}
+
+	store, err = OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store due to error %v", err)
+	}
+	defer store.Close()
+	tree, err = OpenTree(store, HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to open Tree due to error %v", err)
+	}
+	assertMatchesInMemory(t, tree, data)
+	removed := []byte("Hello8")
+	if _, err := tree.GenerateMerkleProof(&removed); err == nil {
+		t.Fatalf("Expected removed leaf to no longer be found after reopening")
+	}
+	data = append(data, []byte("Appended"))
+	if err := tree.AppendLeaf(data[8]); err != nil {
+		t.Fatalf("Failed to append leaf due to error %v", err)
+	}
+	assertMatchesInMemory(t, tree, data)
+}
+
+func TestFileNodeStoreTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	store, _ := OpenFileNodeStore(path)
+	data := testData(5)
+	tree, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	//Simulate a crash in the middle of writing a record at the end of the log
+	size := store.size
+	store.file.WriteAt([]byte{1, 2, 3, 4, 5, 6}, size)
+	store.Close()
+
+	store, err = OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store due to error %v", err)
+	}
+	defer store.Close()
+	if info, _ := store.file.Stat(); store.size != size || info.Size() != size {
+		t.Fatalf("Expected torn record to be dropped, file is %d bytes instead of %d", info.Size(), size)
+	}
+	reopened, err := OpenTree(store, HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to open Tree due to error %v", err)
+	}
+	if !bytes.Equal(reopened.RootHash(), tree.RootHash()) {
+		t.Fatalf("Root doesn't match after dropping torn record")
+	}
+	data = append(data, []byte("Appended"))
+	if err := reopened.AppendLeaf(data[5]); err != nil {
+		t.Fatalf("Failed to append leaf due to error %v", err)
+	}
+	assertMatchesInMemory(t, reopened, data)
+
+	//A record damaged after being written fails its checksum
+	offset, _ := store.readSlot(0, 2)
+	store.file.WriteAt([]byte{0xff}, offset+12)
+	if _, err := store.GetNode(0, 2); !errors.Is(err, ErrCorruptedStore) {
+		t.Fatalf("Expected ErrCorruptedStore reading damaged record, got %v", err)
+	}
+}
+
+func TestFileNodeStoreCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	store, _ := OpenFileNodeStore(path)
+	data := testData(6)
+	tree, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatalf("Failed to sync store due to error %v", err)
+	}
+	synced := store.size
+	old := data[2]
+	data[2] = []byte("Updated")
+	if err := tree.UpdateLeafAt(2, data[2]); err != nil {
+		t.Fatalf("Failed to update leaf due to error %v", err)
+	}
+	//Crash in the middle of an operation, after it wrote a leaf and one node above it
+	store.PutNode(0, 3, []byte("0123456789abcdef0123456789abcdef"))
+	store.PutNode(1, 1, []byte("0123456789abcdef0123456789abcdef"))
+	store.closeFiles()
+
+	store, err = OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store due to error %v", err)
+	}
+	reopened, err := OpenTree(store, HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to open Tree due to error %v", err)
+	}
+	assertMatchesInMemory(t, reopened, data)
+	if _, err := reopened.GenerateMerkleProof(&old); !errors.Is(err, ErrLeafNotFound) {
+		t.Fatalf("Expected updated leaf to no longer be found by its old value, got %v", err)
+	}
+	store.closeFiles()
+
+	//Losing every write made since the last sync leaves indexes pointing past the log
+	os.Truncate(path, synced)
+	store, err = OpenFileNodeStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store due to error %v", err)
+	}
+	reopened, err = OpenTree(store, HashFuncSHA256)
+	if err != nil {
+		t.Fatalf("Failed to open Tree due to error %v", err)
+	}
+	data[2] = old
+	assertMatchesInMemory(t, reopened, data)
+
+	//Records that were synced can't be torn by a crash, so a bad one is reported rather than dropped
+	reopened.AppendLeaf([]byte("Appended"))
+	store.file.WriteAt([]byte{0xff}, fileStoreHeaderLen+12)
+	store.closeFiles()
+	if _, err := OpenFileNodeStore(path); !errors.Is(err, ErrCorruptedStore) {
+		t.Fatalf("Expected ErrCorruptedStore opening store with a damaged synced record, got %v", err)
+	}
+}
+
+func TestOpenTreeRootMismatch(t *testing.T) {
+	data := testData(5)
+	store := NewMemoryNodeStore()
+	tree, _ := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	//A store that doesn't commit may lose the last writes of an operation, here the root
+	store.PutNode(tree.Depth-1, 0, tree.RootHash())
+	if _, err := OpenTree(store, HashFuncSHA256); !errors.Is(err, ErrCorruptedStore) {
+		t.Fatalf("Expected ErrCorruptedStore opening a tree whose root doesn't match its children, got %v", err)
+	}
+}
+
+func TestFileNodeStoreShortFile(t *testing.T) {
+	dir := t.TempDir()
+	torn := filepath.Join(dir, "torn.db")
+	os.WriteFile(torn, []byte(fileStoreMagic[:3]), 0o644)
+	store, err := OpenFileNodeStore(torn)
+	if err != nil {
+		t.Fatalf("Failed to open store with a torn header due to error %v", err)
+	}
+	store.Close()
+
+	other := filepath.Join(dir, "notes.txt")
+	os.WriteFile(other, []byte("notes"), 0o644)
+	if _, err := OpenFileNodeStore(other); !errors.Is(err, ErrCorruptedStore) {
+		t.Fatalf("Expected ErrCorruptedStore opening a short file that isn't a store, got %v", err)
+	}
+	if content, _ := os.ReadFile(other); string(content) != "notes" {
+		t.Fatalf("Opening a file that isn't a store changed its content to %q", content)
+	}
+}
+
+func TestFileNodeStoreFailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	store, _ := OpenFileNodeStore(path)
+	data := testData(5)
+	tree, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	size := store.size
+	store.file.Close()
+	if err := store.PutNode(0, 100, tree.RootHash()); err == nil {
+		t.Fatalf("Expected error writing to a closed file")
+	}
+	if store.size != size {
+		t.Fatalf("Failed write moved end of file from %d to %d", size, store.size)
+	}
+}
+
+func TestFileNodeStoreMemory(t *testing.T) {
+	const count = 1 << 15
+	data := testData(count)
+	path := filepath.Join(t.TempDir(), "tree.db")
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	store, _ := OpenFileNodeStore(path)
+	defer store.Close()
+	tree, err := NewTree(&data, HashFuncSHA256, WithNodeStore(store))
+	if err != nil {
+		t.Fatalf("Failed to build Tree due to error %v", err)
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	//Keeping a position or hash per node would take several MB for this many leaves
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 64<<10 {
+		t.Fatalf("Store of %d leaves holds %d bytes in memory", count, grown)
+	}
+	hash, _ := tree.hashLeaf(data[count-3])
+	if index, found := store.FindLeaf(hash); !found || index != count-3 {
+		t.Fatalf("Expected leaf %d to be found in the leaf table, got %d, %t", count-3, index, found)
+	}
+	runtime.KeepAlive(tree)
+	runtime.KeepAlive(data)
+}
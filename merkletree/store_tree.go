@@ -0,0 +1,302 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+/*
+Loads a tree previously built in store using WithNodeStore.
+Options must be the same as the ones used to build the tree, they are not recorded in the store.
+Accepts
+  - store holding the tree
+  - Hash function used to build the tree
+  - Optional settings the tree was built with
+
+Returns
+  - Reference to the tree in case of no errors
+  - error in case store doesn't hold a tree, or ErrCorruptedStore if its root doesn't match the level below it
+*/
+func OpenTree(store NodeStore, hashFunc HashFunction, opts ...Option) (*MerkleTree, error) {
+	if err := VerifyHashFuncMinSecurity(hashFunc); err != nil {
+		return nil, err
+	}
+	var tree MerkleTree
+	tree.HashFunc = hashFunc
+	tree.config = newTreeConfig(opts)
+	tree.config.store = store
+	if err := tree.config.checkBranching(); err != nil {
+		return nil, err
+	}
+	leafCount := store.LeafCount()
+	if leafCount == 0 {
+		return nil, fmt.Errorf("%w: node store doesn't hold a merkle tree", ErrEmptyData)
+	}
+	tree.Depth = tree.config.depth(leafCount)
+	root, err := store.GetNode(tree.Depth, 0)
+	if err != nil {
+		return nil, err
+	}
+	//Stores that don't commit their writes may hold part of an operation, leaving a root that doesn't match its children
+	if tree.Depth > 0 {
+		size := leafCount
+		for level := 1; level < tree.Depth; level++ {
+			size = (size + 1) / 2
+		}
+		expected, err := tree.storeParent(tree.Depth-1, 0, size)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(expected, root) {
+			return nil, fmt.Errorf("%w: stored root doesn't match the level below it", ErrCorruptedStore)
+		}
+	}
+	tree.Root = &Node{Hash: root}
+	return &tree, nil
+}
+
+/*
+Writes leaf hashes and all levels above them to the store.
+*/
+func (t *MerkleTree) buildInStore(data *Data) error {
+	store := t.config.store
+	if store.LeafCount() != 0 {
+		return fmt.Errorf("%w: node store already holds a merkle tree, use OpenTree to load it", ErrUnsupported)
+	}
+	hashes := make([][]byte, len(*data))
+	for i, value := range *data {
+		hash, err := t.hashLeaf(value)
+		if err != nil {
+			return err
+		}
+		hashes[i] = hash
+	}
+	if t.config.sortedLeaves {
+		sort.Slice(hashes, func(i, j int) bool {
+			return bytes.Compare(hashes[i], hashes[j]) < 0
+		})
+	}
+	for i, hash := range hashes {
+		if err := store.PutNode(0, i, hash); err != nil {
+			return err
+		}
+	}
+	if err := store.SetLeafCount(len(*data)); err != nil {
+		return err
+	}
+	t.Depth = t.config.depth(len(*data))
+	return t.rehashStore(0, len(*data))
+}
+
+/*
+Recomputes and stores the nodes covering leaf positions [start, end) at every level, followed by the root.
+Every operation writing to the store ends here, so the writes are committed once the root is stored.
+*/
+func (t *MerkleTree) rehashStore(start int, end int) error {
+	store := t.config.store
+	size := store.LeafCount()
+	for level := 0; level < t.Depth; level++ {
+		parentSize := (size + 1) / 2
+		last := (end + 1) / 2
+		if last > parentSize {
+			last = parentSize
+		}
+		for p := start / 2; p < last; p++ {
+			hash, err := t.storeParent(level, p, size)
+			if err != nil {
+				return err
+			}
+			if err := store.PutNode(level+1, p, hash); err != nil {
+				return err
+			}
+		}
+		start, end, size = start/2, last, parentSize
+	}
+	if committer, ok := store.(CommitNodeStore); ok {
+		if err := committer.Commit(); err != nil {
+			return err
+		}
+	}
+	root, err := store.GetNode(t.Depth, 0)
+	if err != nil {
+		return err
+	}
+	t.Root = &Node{Hash: root}
+	return nil
+}
+
+/*
+Returns hash of the parent at index p of a level holding size nodes, from the stored children.
+*/
+func (t *MerkleTree) storeParent(level int, p int, size int) ([]byte, error) {
+	left, err := t.config.store.GetNode(level, 2*p)
+	if err != nil {
+		return nil, err
+	}
+	if 2*p+1 == size {
+		if t.config.promoteOddNodes {
+			return left, nil
+		}
+		return t.hashNode(left, left)
+	}
+	right, err := t.config.store.GetNode(level, 2*p+1)
+	if err != nil {
+		return nil, err
+	}
+	return t.hashNode(left, right)
+}
+
+/*
+Returns hash of the node at index of level, from the store or the nodes held in memory.
+*/
+func (t *MerkleTree) nodeHash(level int, index int) ([]byte, error) {
+	if t.config.store != nil {
+		return t.config.store.GetNode(level, index)
+	}
+	if err := t.ensureLevels(); err != nil {
+		return nil, err
+	}
+	node := t.levels[level][index]
+	if node == nil {
+		return nil, fmt.Errorf("%w: node %d at level %d is part of a collapsed subtree", ErrPruned, index, level)
+	}
+	return node.Hash, nil
+}
+
+func (t *MerkleTree) storeProof(index int) (*Proof, error) {
+	var proof Proof
+	proof.Hashes = make([][]byte, 0, t.Depth)
+	proof.Indexes = make([]int, 0, t.Depth)
+	size := t.LeafCount()
+	for level := 0; level < t.Depth; level++ {
+		sibling := index ^ 1
+		if sibling >= size {
+			sibling = index
+		}
+		if sibling != index || !t.config.promoteOddNodes {
+			hash, err := t.config.store.GetNode(level, sibling)
+			if err != nil {
+				return nil, err
+			}
+			proof.Hashes = append(proof.Hashes, hash)
+			proof.Indexes = append(proof.Indexes, 1-index%2)
+		}
+		index /= 2
+		size = (size + 1) / 2
+	}
+	proof.HashID = t.HashID
+	return &proof, nil
+}
+
+func (t *MerkleTree) storePath(index int) (*Proof, error) {
+	var proof Proof
+	proof.Hashes = make([][]byte, 0, t.Depth+1)
+	proof.Indexes = make([]int, 0, t.Depth+1)
+	size := t.LeafCount()
+	for level := 0; level < t.Depth; level++ {
+		//Promoted nodes have no parent of their own at the next level
+		if index^1 < size || !t.config.promoteOddNodes {
+			hash, err := t.config.store.GetNode(level, index)
+			if err != nil {
+				return nil, err
+			}
+			proof.Hashes = append(proof.Hashes, hash)
+			proof.Indexes = append(proof.Indexes, index%2)
+		}
+		index /= 2
+		size = (size + 1) / 2
+	}
+	proof.Hashes = append(proof.Hashes, t.RootHash())
+	proof.Indexes = append(proof.Indexes, 0)
+	proof.HashID = t.HashID
+	return &proof, nil
+}
+
+func (t *MerkleTree) storeUpdateLeaf(index int, hash []byte) error {
+	if err := t.config.store.PutNode(0, index, hash); err != nil {
+		return err
+	}
+	return t.rehashStore(index, index+1)
+}
+
+func (t *MerkleTree) storeAppendLeaf(hash []byte) error {
+	store := t.config.store
+	index := store.LeafCount()
+	if err := store.PutNode(0, index, hash); err != nil {
+		return err
+	}
+	if err := store.SetLeafCount(index + 1); err != nil {
+		return err
+	}
+	t.Depth = t.config.depth(index + 1)
+	return t.rehashStore(index, index+1)
+}
+
+func (t *MerkleTree) storeRemoveLeaf(index int) error {
+	store := t.config.store
+	count := store.LeafCount()
+	for i := index; i < count-1; i++ {
+		hash, err := store.GetNode(0, i+1)
+		if err != nil {
+			return err
+		}
+		if err := store.PutNode(0, i, hash); err != nil {
+			return err
+		}
+	}
+	if err := store.SetLeafCount(count - 1); err != nil {
+		return err
+	}
+	t.Depth = t.config.depth(count - 1)
+	return t.rehashStore(index, count-1)
+}
+
+func (t *MerkleTree) storeInsertLeaf(index int, hash []byte) error {
+	store := t.config.store
+	count := store.LeafCount()
+	for i := count; i > index; i-- {
+		shifted, err := store.GetNode(0, i-1)
+		if err != nil {
+			return err
+		}
+		if err := store.PutNode(0, i, shifted); err != nil {
+			return err
+		}
+	}
+	if err := store.PutNode(0, index, hash); err != nil {
+		return err
+	}
+	if err := store.SetLeafCount(count + 1); err != nil {
+		return err
+	}
+	t.Depth = t.config.depth(count + 1)
+	return t.rehashStore(index, count+1)
+}
+
+/*
+Stores hash at position, shifting the leaves between index and position by one towards index.
+*/
+func (t *MerkleTree) storeMoveLeaf(index int, position int, hash []byte) error {
+	store := t.config.store
+	step := 1
+	if position < index {
+		step = -1
+	}
+	for i := index; i != position; i += step {
+		shifted, err := store.GetNode(0, i+step)
+		if err != nil {
+			return err
+		}
+		if err := store.PutNode(0, i, shifted); err != nil {
+			return err
+		}
+	}
+	if err := store.PutNode(0, position, hash); err != nil {
+		return err
+	}
+	if position < index {
+		index, position = position, index
+	}
+	return t.rehashStore(index, position+1)
+}
@@ -0,0 +1,70 @@
+package trie
+
+/*
+Converts key bytes into nibbles, appending the terminator nibble 16 that marks a leaf.
+*/
+func keybytesToHex(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2+1)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[len(nibbles)-1] = terminator
+	return nibbles
+}
+
+/*
+Encodes nibbles using the hex prefix encoding from the Ethereum yellow paper appendix C.
+The flag in the high nibble of the first byte tells whether the path has odd length and ends in a leaf.
+*/
+func hexToCompact(hex []byte) []byte {
+	var flag byte
+	if hasTerm(hex) {
+		flag = 2
+		hex = hex[:len(hex)-1]
+	}
+	buf := make([]byte, len(hex)/2+1)
+	if len(hex)%2 == 1 {
+		flag |= 1
+		buf[0] = hex[0]
+		hex = hex[1:]
+	}
+	buf[0] |= flag << 4
+	for i := 0; i < len(hex); i += 2 {
+		buf[i/2+1] = hex[i]<<4 | hex[i+1]
+	}
+	return buf
+}
+
+/*
+Decodes a hex prefix encoded path into nibbles, appending the terminator for leaves.
+*/
+func compactToHex(compact []byte) []byte {
+	if len(compact) == 0 {
+		return nil
+	}
+	flag := compact[0] >> 4
+	var hex []byte
+	if flag&1 == 1 {
+		hex = append(hex, compact[0]&0x0f)
+	}
+	for _, b := range compact[1:] {
+		hex = append(hex, b>>4, b&0x0f)
+	}
+	if flag&2 == 2 {
+		hex = append(hex, terminator)
+	}
+	return hex
+}
+
+func hasTerm(hex []byte) bool {
+	return len(hex) > 0 && hex[len(hex)-1] == terminator
+}
+
+func prefixLen(a []byte, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
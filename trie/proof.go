@@ -0,0 +1,141 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+)
+
+/*
+Generates a proof for key, which is the RLP encoding of every node on its path that is referred to by hash, starting from the root.
+Nodes embedded in their parent are part of the parent's encoding. For absent keys the proof shows where the path ends.
+This is the same format as the proofs returned by Ethereum's eth_getProof.
+Accepts
+  - key for which proof has to be generated
+
+Returns
+  - list of encoded nodes
+*/
+func (t *Trie) Prove(key []byte) [][]byte {
+	var proof [][]byte
+	path := t.path(key)
+	for n := t.root; n != nil; {
+		if _, isValue := n.(valueNode); isValue {
+			return proof
+		}
+		if enc := encodeNode(n); n == t.root || len(enc) >= 32 {
+			proof = append(proof, enc)
+		}
+		switch cur := n.(type) {
+		case *shortNode:
+			if len(path) < len(cur.Key) || !bytes.Equal(cur.Key, path[:len(cur.Key)]) {
+				return proof
+			}
+			path = path[len(cur.Key):]
+			n = cur.Val
+		case *fullNode:
+			n = cur.Children[path[0]]
+			path = path[1:]
+		}
+	}
+	return proof
+}
+
+/*
+Verifies a proof generated by Prove against a trusted root hash.
+For tries created using NewSecure, key must be the Keccak-256 hash of the key.
+Accepts
+  - trusted root hash of the trie
+  - key the proof is for
+  - list of encoded nodes
+
+Returns
+  - value stored for key, nil if proof shows key is absent
+  - error in case proof is invalid or incomplete
+*/
+func VerifyProof(rootHash []byte, key []byte, proof [][]byte) ([]byte, error) {
+	nodes := make(map[string][]byte, len(proof))
+	for _, enc := range proof {
+		nodes[string(Keccak256(enc))] = enc
+	}
+	path := keybytesToHex(key)
+	wanted := rootHash
+	for {
+		enc, found := nodes[string(wanted)]
+		if !found {
+			return nil, fmt.Errorf("proof is missing node %x", wanted)
+		}
+		item, err := decodeRLP(enc)
+		if err != nil {
+			return nil, err
+		}
+		value, next, err := walkNode(item, path)
+		if err != nil || next == nil {
+			return value, err
+		}
+		//Walk embedded nodes until reaching one referred to by hash
+		for next.item != nil {
+			if value, next, err = walkNode(*next.item, next.path); err != nil || next == nil {
+				return value, err
+			}
+		}
+		wanted, path = next.hash, next.path
+	}
+}
+
+// Where to continue the walk, either a hash to look up or an embedded node
+type proofStep struct {
+	hash []byte
+	item *rlpItem
+	path []byte
+}
+
+/*
+Follows path through a decoded node. Returns either the value at the end of the path, or the next step.
+*/
+func walkNode(item rlpItem, path []byte) ([]byte, *proofStep, error) {
+	if !item.IsList {
+		return nil, nil, fmt.Errorf("invalid trie node, expected a list")
+	}
+	switch len(item.List) {
+	case 2:
+		if item.List[0].IsList {
+			return nil, nil, fmt.Errorf("invalid short node key")
+		}
+		key := compactToHex(item.List[0].String)
+		if len(path) < len(key) || !bytes.Equal(key, path[:len(key)]) {
+			return nil, nil, nil
+		}
+		if hasTerm(key) {
+			return valueOf(item.List[1])
+		}
+		return nextStep(item.List[1], path[len(key):])
+	case 17:
+		if path[0] == terminator {
+			return valueOf(item.List[terminator])
+		}
+		return nextStep(item.List[path[0]], path[1:])
+	}
+	return nil, nil, fmt.Errorf("invalid trie node with %d items", len(item.List))
+}
+
+func valueOf(item rlpItem) ([]byte, *proofStep, error) {
+	if item.IsList {
+		return nil, nil, fmt.Errorf("invalid value node")
+	}
+	if len(item.String) == 0 {
+		return nil, nil, nil
+	}
+	return item.String, nil, nil
+}
+
+func nextStep(ref rlpItem, path []byte) ([]byte, *proofStep, error) {
+	switch {
+	case ref.IsList:
+		return nil, &proofStep{item: &ref, path: path}, nil
+	case len(ref.String) == 0:
+		return nil, nil, nil
+	case len(ref.String) == 32:
+		return nil, &proofStep{hash: ref.String, path: path}, nil
+	}
+	return nil, nil, fmt.Errorf("invalid node reference of %d bytes", len(ref.String))
+}
@@ -0,0 +1,130 @@
+package trie
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/*
+Minimal RLP encoding as described in the Ethereum yellow paper appendix B.
+Only byte strings and lists are supported, which is all trie nodes need.
+*/
+
+func encodeString(s []byte) []byte {
+	if len(s) == 1 && s[0] < 0x80 {
+		return []byte{s[0]}
+	}
+	return append(encodeLength(len(s), 0x80), s...)
+}
+
+/*
+Wraps already encoded items into a list.
+*/
+func encodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	buf := encodeLength(size, 0xc0)
+	for _, item := range items {
+		buf = append(buf, item...)
+	}
+	return buf
+}
+
+func encodeLength(length int, offset byte) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	var lenBytes [8]byte
+	binary.BigEndian.PutUint64(lenBytes[:], uint64(length))
+	i := 0
+	for lenBytes[i] == 0 {
+		i++
+	}
+	return append([]byte{offset + 55 + byte(8-i)}, lenBytes[i:]...)
+}
+
+/*
+Decoded RLP item, either a byte string or a list of items.
+Raw holds the complete encoding of the item.
+*/
+type rlpItem struct {
+	IsList bool
+	String []byte
+	List   []rlpItem
+	Raw    []byte
+}
+
+/*
+Decodes a single RLP item that must span the whole input.
+*/
+func decodeRLP(data []byte) (rlpItem, error) {
+	item, rest, err := decodeItem(data)
+	if err != nil {
+		return item, err
+	}
+	if len(rest) != 0 {
+		return item, fmt.Errorf("rlp: %d trailing bytes", len(rest))
+	}
+	return item, nil
+}
+
+func decodeItem(data []byte) (rlpItem, []byte, error) {
+	var item rlpItem
+	if len(data) == 0 {
+		return item, nil, fmt.Errorf("rlp: unexpected end of input")
+	}
+	prefix := data[0]
+	var offset, size int
+	switch {
+	case prefix < 0x80:
+		item.String = data[:1]
+		item.Raw = data[:1]
+		return item, data[1:], nil
+	case prefix < 0xb8:
+		offset, size = 1, int(prefix-0x80)
+	case prefix < 0xc0:
+		lenSize := int(prefix - 0xb7)
+		offset, size = decodeLongLength(data, lenSize)
+	case prefix < 0xf8:
+		item.IsList = true
+		offset, size = 1, int(prefix-0xc0)
+	default:
+		item.IsList = true
+		lenSize := int(prefix - 0xf7)
+		offset, size = decodeLongLength(data, lenSize)
+	}
+	if size < 0 || offset+size > len(data) || offset+size < offset {
+		return item, nil, fmt.Errorf("rlp: item larger than input")
+	}
+	payload := data[offset : offset+size]
+	item.Raw = data[:offset+size]
+	if !item.IsList {
+		item.String = payload
+		return item, data[offset+size:], nil
+	}
+	for len(payload) > 0 {
+		child, rest, err := decodeItem(payload)
+		if err != nil {
+			return item, nil, err
+		}
+		item.List = append(item.List, child)
+		payload = rest
+	}
+	return item, data[offset+size:], nil
+}
+
+func decodeLongLength(data []byte, lenSize int) (int, int) {
+	if len(data) < 1+lenSize || lenSize > 8 {
+		return 0, -1
+	}
+	var size uint64
+	for _, b := range data[1 : 1+lenSize] {
+		size = size<<8 | uint64(b)
+	}
+	if size > uint64(len(data)) {
+		return 0, -1
+	}
+	return 1 + lenSize, int(size)
+}
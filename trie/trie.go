@@ -0,0 +1,281 @@
+package trie
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Nibble marking the end of a key, stored as the last nibble of leaf paths
+const terminator = 16
+
+// Root hash of an empty trie, Keccak-256 of the RLP encoding of an empty string
+var EmptyRoot = []byte{
+	0x56, 0xe8, 0x1f, 0x17, 0x1b, 0xcc, 0x55, 0xa6, 0xff, 0x83, 0x45, 0xe6, 0x92, 0xc0, 0xf8, 0x6e,
+	0x5b, 0x48, 0xe0, 0x1b, 0x99, 0x6c, 0xad, 0xc0, 0x01, 0x62, 0x2f, 0xb5, 0xe3, 0x63, 0xb4, 0x21,
+}
+
+/*
+Node of the trie. One of
+  - *fullNode : branch with a child per nibble and an optional value
+  - *shortNode : extension or leaf holding a path shared by everything below it
+  - valueNode : value stored at the end of a key
+*/
+type node interface{}
+
+type fullNode struct {
+	Children [17]node
+	cache    nodeCache
+}
+
+type shortNode struct {
+	//Path as nibbles, ending with the terminator for leaves
+	Key   []byte
+	Val   node
+	cache nodeCache
+}
+
+type valueNode []byte
+
+// Encoding of a node, cached until the node is replaced by a modified copy
+type nodeCache struct {
+	enc []byte
+}
+
+/*
+Hexary Merkle Patricia trie with RLP node encoding and Keccak-256 hashing, producing the same roots as Ethereum.
+Modifications copy the nodes on the path to the key, so cached encodings of other nodes stay valid.
+*/
+type Trie struct {
+	root node
+	//Keys are hashed with Keccak-256 before use, as done for Ethereum's state and storage tries
+	secure bool
+}
+
+/*
+Creates an empty trie using keys as they are.
+*/
+func New() *Trie {
+	return &Trie{}
+}
+
+/*
+Creates an empty trie which hashes keys with Keccak-256 before use, like Ethereum's state and storage tries.
+*/
+func NewSecure() *Trie {
+	return &Trie{secure: true}
+}
+
+/*
+Returns Keccak-256 hash of data, as used by Ethereum.
+*/
+func Keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (t *Trie) path(key []byte) []byte {
+	if t.secure {
+		key = Keccak256(key)
+	}
+	return keybytesToHex(key)
+}
+
+/*
+Returns the root hash of the trie.
+*/
+func (t *Trie) Hash() []byte {
+	if t.root == nil {
+		return append([]byte{}, EmptyRoot...)
+	}
+	return Keccak256(encodeNode(t.root))
+}
+
+/*
+Returns the value stored for key.
+Accepts
+  - key to look up
+
+Returns
+  - value stored for the key
+  - error in case key is not present in the trie
+*/
+func (t *Trie) Get(key []byte) ([]byte, error) {
+	value := get(t.root, t.path(key))
+	if value == nil {
+		return nil, fmt.Errorf("key doesn't exist in the trie")
+	}
+	return value, nil
+}
+
+func get(n node, key []byte) []byte {
+	switch n := n.(type) {
+	case valueNode:
+		return n
+	case *shortNode:
+		if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+			return nil
+		}
+		return get(n.Val, key[len(n.Key):])
+	case *fullNode:
+		return get(n.Children[key[0]], key[1:])
+	}
+	return nil
+}
+
+/*
+Stores value for key, replacing any existing value.
+As in Ethereum, storing an empty value removes the key.
+Accepts
+  - key to store the value for
+  - value to be stored
+*/
+func (t *Trie) Insert(key []byte, value []byte) {
+	if len(value) == 0 {
+		t.root, _ = remove(t.root, t.path(key))
+		return
+	}
+	t.root = insert(t.root, t.path(key), valueNode(append([]byte{}, value...)))
+}
+
+func insert(n node, key []byte, value node) node {
+	if len(key) == 0 {
+		return value
+	}
+	switch n := n.(type) {
+	case *shortNode:
+		matchLen := prefixLen(key, n.Key)
+		if matchLen == len(n.Key) {
+			return &shortNode{Key: n.Key, Val: insert(n.Val, key[matchLen:], value)}
+		}
+		//Paths diverge, branch out at the first differing nibble
+		branch := &fullNode{}
+		branch.Children[n.Key[matchLen]] = insert(nil, n.Key[matchLen+1:], n.Val)
+		branch.Children[key[matchLen]] = insert(nil, key[matchLen+1:], value)
+		if matchLen == 0 {
+			return branch
+		}
+		return &shortNode{Key: key[:matchLen], Val: branch}
+	case *fullNode:
+		cpy := &fullNode{Children: n.Children}
+		cpy.Children[key[0]] = insert(n.Children[key[0]], key[1:], value)
+		return cpy
+	default:
+		return &shortNode{Key: key, Val: value}
+	}
+}
+
+/*
+Removes key from the trie.
+Accepts
+  - key to be removed
+
+Returns
+  - error in case key is not present in the trie
+*/
+func (t *Trie) Delete(key []byte) error {
+	root, removed := remove(t.root, t.path(key))
+	if !removed {
+		return fmt.Errorf("key doesn't exist in the trie")
+	}
+	t.root = root
+	return nil
+}
+
+/*
+Removes key below n and returns the replacement for n, collapsing branches left with a single child.
+*/
+func remove(n node, key []byte) (node, bool) {
+	switch n := n.(type) {
+	case valueNode:
+		return nil, true
+	case *shortNode:
+		matchLen := prefixLen(key, n.Key)
+		if matchLen < len(n.Key) {
+			return n, false
+		}
+		if matchLen == len(key) {
+			return nil, true
+		}
+		child, removed := remove(n.Val, key[len(n.Key):])
+		if !removed {
+			return n, false
+		}
+		if child, ok := child.(*shortNode); ok {
+			//Merge the paths, a short node never points to another short node
+			return &shortNode{Key: concat(n.Key, child.Key...), Val: child.Val}, true
+		}
+		return &shortNode{Key: n.Key, Val: child}, true
+	case *fullNode:
+		child, removed := remove(n.Children[key[0]], key[1:])
+		if !removed {
+			return n, false
+		}
+		cpy := &fullNode{Children: n.Children}
+		cpy.Children[key[0]] = child
+		pos := -1
+		for i, c := range &cpy.Children {
+			if c != nil {
+				if pos != -1 {
+					return cpy, true
+				}
+				pos = i
+			}
+		}
+		//Only one child left, replace the branch with a short node
+		if pos != terminator {
+			if child, ok := cpy.Children[pos].(*shortNode); ok {
+				return &shortNode{Key: concat([]byte{byte(pos)}, child.Key...), Val: child.Val}, true
+			}
+		}
+		return &shortNode{Key: []byte{byte(pos)}, Val: cpy.Children[pos]}, true
+	}
+	return nil, false
+}
+
+func concat(a []byte, b ...byte) []byte {
+	r := make([]byte, 0, len(a)+len(b))
+	return append(append(r, a...), b...)
+}
+
+/*
+Returns the RLP encoding of a full or short node.
+*/
+func encodeNode(n node) []byte {
+	switch n := n.(type) {
+	case *shortNode:
+		if n.cache.enc == nil {
+			n.cache.enc = encodeList(encodeString(hexToCompact(n.Key)), reference(n.Val))
+		}
+		return n.cache.enc
+	case *fullNode:
+		if n.cache.enc == nil {
+			items := make([][]byte, len(n.Children))
+			for i, child := range &n.Children {
+				items[i] = reference(child)
+			}
+			n.cache.enc = encodeList(items...)
+		}
+		return n.cache.enc
+	}
+	panic(fmt.Sprintf("trie: cannot encode %T", n))
+}
+
+/*
+Returns how a parent refers to n. Nodes encoding to less than 32 bytes are embedded, others are referred to by hash.
+*/
+func reference(n node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return encodeString(nil)
+	case valueNode:
+		return encodeString(n)
+	}
+	enc := encodeNode(n)
+	if len(enc) < 32 {
+		return enc
+	}
+	return encodeString(Keccak256(enc))
+}
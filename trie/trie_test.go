@@ -0,0 +1,194 @@
+package trie
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Vectors from trieanyorder.json and trietest.json in github.com/ethereum/tests
+var anyOrderTests = []struct {
+	name string
+	kv   [][2]string
+	root string
+}{
+	{"singleItem", [][2]string{{"A", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+		"d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab"},
+	{"dogs", [][2]string{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}},
+		"8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+	{"puppy", [][2]string{{"do", "verb"}, {"horse", "stallion"}, {"doge", "coin"}, {"dog", "puppy"}},
+		"5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"},
+	{"foo", [][2]string{{"foo", "bar"}, {"food", "bass"}},
+		"17beaa1648bafa633cda809c90c04af50fc8aed3cb40d16efbddee6fdf63c4c3"},
+	{"smallValues", [][2]string{{"be", "e"}, {"dog", "puppy"}, {"bed", "d"}},
+		"3f67c7a47520f79faa29255d2d3c084a7a6df0453116ed7232ff10277a8be68b"},
+	{"testy", [][2]string{{"test", "test"}, {"te", "testy"}},
+		"8452568af70d8d140f58d941338542f645fcca50094b20f3c3d8c3df49337928"},
+	{"hex", [][2]string{{"0x0045", "0x0123456789"}, {"0x4500", "0x9876543210"}},
+		"285505fcabe84badc8aa310e2aae17eddc7d120aabec8a476902c8184b3a3503"},
+}
+
+// Values prefixed with 0x are hex encoded in the test vectors
+func vectorBytes(t *testing.T, s string) []byte {
+	if !strings.HasPrefix(s, "0x") {
+		return []byte(s)
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		t.Fatalf("Invalid test vector %q", s)
+	}
+	return b
+}
+
+func TestEmptyTrie(t *testing.T) {
+	trie := New()
+	if hex.EncodeToString(trie.Hash()) != hex.EncodeToString(Keccak256(encodeString(nil))) {
+		t.Fatalf("Unexpected root hash %x for empty trie", trie.Hash())
+	}
+	if _, err := trie.Get([]byte("missing")); err == nil {
+		t.Fatalf("Expected error getting key from empty trie")
+	}
+}
+
+func TestTrieVectorsAnyOrder(t *testing.T) {
+	for _, test := range anyOrderTests {
+		for trial := 0; trial < 5; trial++ {
+			trie := New()
+			for _, i := range rand.Perm(len(test.kv)) {
+				trie.Insert(vectorBytes(t, test.kv[i][0]), vectorBytes(t, test.kv[i][1]))
+			}
+			if root := hex.EncodeToString(trie.Hash()); root != test.root {
+				t.Fatalf("Root for %s is %s, expected %s", test.name, root, test.root)
+			}
+			for _, kv := range test.kv {
+				value, err := trie.Get(vectorBytes(t, kv[0]))
+				if err != nil || string(value) != string(vectorBytes(t, kv[1])) {
+					t.Fatalf("Unexpected value %q for key %q in %s, error %v", value, kv[0], test.name, err)
+				}
+			}
+		}
+	}
+}
+
+// Sequence from the "puppy" vector in trietest.json, where empty values delete keys
+func TestTrieInsertDelete(t *testing.T) {
+	updates := [][2]string{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"ether", ""},
+		{"dog", "puppy"},
+		{"shaman", ""},
+	}
+	trie := New()
+	for _, kv := range updates {
+		trie.Insert([]byte(kv[0]), []byte(kv[1]))
+	}
+	if root := hex.EncodeToString(trie.Hash()); root != "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84" {
+		t.Fatalf("Unexpected root %s after inserts and deletes", root)
+	}
+	for _, key := range []string{"do", "horse", "doge", "dog"} {
+		if err := trie.Delete([]byte(key)); err != nil {
+			t.Fatalf("Failed to delete %q due to error %v", key, err)
+		}
+	}
+	if root := hex.EncodeToString(trie.Hash()); root != hex.EncodeToString(EmptyRoot) {
+		t.Fatalf("Expected empty root after deleting all keys, got %s", root)
+	}
+	if err := trie.Delete([]byte("dog")); err == nil {
+		t.Fatalf("Expected error deleting absent key")
+	}
+}
+
+func TestTrieDeleteMatchesFreshTrie(t *testing.T) {
+	keys := make([][]byte, 300)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", rand.Intn(1000)))
+	}
+	trie := New()
+	for _, key := range keys {
+		trie.Insert(key, append([]byte("value-"), key...))
+	}
+	remaining := make(map[string]bool)
+	for _, key := range keys {
+		remaining[string(key)] = true
+	}
+	for i, key := range keys {
+		if i%3 != 0 || !remaining[string(key)] {
+			continue
+		}
+		if err := trie.Delete(key); err != nil {
+			t.Fatalf("Failed to delete %q due to error %v", key, err)
+		}
+		delete(remaining, string(key))
+	}
+	fresh := New()
+	for key := range remaining {
+		fresh.Insert([]byte(key), append([]byte("value-"), key...))
+	}
+	if hex.EncodeToString(trie.Hash()) != hex.EncodeToString(fresh.Hash()) {
+		t.Fatalf("Root after deletes doesn't match trie built from remaining keys")
+	}
+}
+
+func TestTrieProofs(t *testing.T) {
+	for _, trie := range []*Trie{New(), NewSecure()} {
+		for i := 0; i < 500; i++ {
+			trie.Insert([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		}
+		//Short values produce nodes embedded in their parents
+		trie.Insert([]byte("k"), []byte("v"))
+		trie.Insert([]byte("kk"), []byte("w"))
+		root := trie.Hash()
+		path := func(key []byte) []byte {
+			if trie.secure {
+				return Keccak256(key)
+			}
+			return key
+		}
+		for _, key := range []string{"key0", "key250", "key499", "k", "kk"} {
+			proof := trie.Prove([]byte(key))
+			value, err := VerifyProof(root, path([]byte(key)), proof)
+			expected, _ := trie.Get([]byte(key))
+			if err != nil || string(value) != string(expected) {
+				t.Fatalf("Failed to verify proof for %q, got %q and error %v", key, value, err)
+			}
+			if _, err := VerifyProof(root, path([]byte(key)), proof[:len(proof)-1]); err == nil && len(proof) > 1 {
+				t.Fatalf("Expected error verifying incomplete proof for %q", key)
+			}
+		}
+		for _, key := range []string{"key500", "absent", "ke"} {
+			proof := trie.Prove([]byte(key))
+			value, err := VerifyProof(root, path([]byte(key)), proof)
+			if err != nil || value != nil {
+				t.Fatalf("Expected proof of absence for %q, got %q and error %v", key, value, err)
+			}
+		}
+		proof := trie.Prove([]byte("key1"))
+		if _, err := VerifyProof(EmptyRoot, path([]byte("key1")), proof); err == nil {
+			t.Fatalf("Expected error verifying proof against a different root")
+		}
+	}
+}
+
+func TestRLPRoundTrip(t *testing.T) {
+	long := []byte(strings.Repeat("x", 1024))
+	enc := encodeList(encodeString([]byte{0x01}), encodeString(nil), encodeString(long), encodeList(encodeString([]byte("dog"))))
+	item, err := decodeRLP(enc)
+	if err != nil {
+		t.Fatalf("Failed to decode RLP due to error %v", err)
+	}
+	if !item.IsList || len(item.List) != 4 || string(item.List[2].String) != string(long) || item.List[3].List[0].String == nil {
+		t.Fatalf("Unexpected decoded item %+v", item)
+	}
+	if _, err := decodeRLP(enc[:len(enc)-1]); err == nil {
+		t.Fatalf("Expected error decoding truncated RLP")
+	}
+	if hex.EncodeToString(encodeString([]byte("dog"))) != "83646f67" {
+		t.Fatalf("Unexpected encoding of \"dog\"")
+	}
+}